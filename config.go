@@ -0,0 +1,169 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/zosopentools/wharf/internal/base"
+)
+
+// Inspect the inline directives Wharf is configured with
+//
+// Usage: wharf config show [-config] [-json] [packages]
+//
+//	wharf config validate [files]
+func configMain(args []string) {
+	if len(args) < 1 {
+		log.Fatal("no config command provided (expected show or validate); see 'wharf --help' for usage")
+	}
+
+	switch args[0] {
+	case "show":
+		configShow(args[1:])
+	case "validate":
+		configValidate(args[1:])
+	default:
+		log.Fatalf("unknown config command %v (expected show or validate)\n", args[0])
+	}
+}
+
+// The layered config, as printed by 'wharf config show -json'
+type configReport struct {
+	Layers   []string
+	Packages []*base.PackageInline
+}
+
+// Print the directives of every config layer, in order of precedence
+func configShow(args []string) {
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	var configFlag listFlag
+	fs.Var(&configFlag, "config", "Config for additional code edits (can be repeated)")
+	jsonFlag := fs.Bool("json", false, "Print the config as JSON")
+	fs.Parse(args)
+
+	if err := base.LoadConfig(configFlag); err != nil {
+		log.Fatalf("unable to load config:\n%v\n", err)
+	}
+
+	pkgnames := fs.Args()
+	if len(pkgnames) == 0 {
+		for pkgname := range base.Inlines {
+			pkgnames = append(pkgnames, pkgname)
+		}
+		sort.Strings(pkgnames)
+	}
+
+	report := configReport{Layers: base.ConfigLayers}
+	for _, pkgname := range pkgnames {
+		report.Packages = append(report.Packages, base.Inlines[pkgname]...)
+	}
+
+	if *jsonFlag {
+		if outstrm, err := json.MarshalIndent(report, "", "\t"); err == nil {
+			fmt.Println(string(outstrm))
+		} else {
+			log.Fatalln(err.Error())
+		}
+		return
+	}
+
+	fmt.Println("config layers (later ones take precedence):")
+	for _, layer := range report.Layers {
+		fmt.Printf("\t%v\n", layer)
+	}
+
+	for _, pkgname := range pkgnames {
+		printPackageConfig(pkgname, base.Inlines[pkgname])
+	}
+}
+
+func printPackageConfig(pkgname string, entries []*base.PackageInline) {
+	fmt.Println("\n#", pkgname)
+	if len(entries) == 0 {
+		fmt.Println("- no directives")
+		return
+	}
+
+	// Where each directive was last defined, to show which ones take precedence
+	defined := make(map[string]base.Location)
+	overrides := func(key string, pos base.Location) string {
+		prev, ok := defined[key]
+		defined[key] = pos
+		if ok {
+			return fmt.Sprintf(" (overrides %v)", prev)
+		}
+		return ""
+	}
+
+	for _, entry := range entries {
+		if entry.Versions != "" {
+			fmt.Printf("- %v (versions %v)\n", entry.Pos, entry.Versions)
+		} else {
+			fmt.Printf("- %v\n", entry.Pos)
+		}
+
+		if entry.Redirect != nil {
+			fmt.Printf("\tredirect to %v@%v%v\n", entry.Redirect.Path, entry.Redirect.Version, overrides("redirect", entry.Redirect.Pos))
+		}
+		names := make([]string, 0, len(entry.Files))
+		for name := range entry.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			file := entry.Files[name]
+			fmt.Printf("\t%v: %v %v%v\n", name, file.Type, file.Path, overrides("files:"+name, file.Pos))
+		}
+		names = make([]string, 0, len(entry.Exports))
+		for name := range entry.Exports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			export := entry.Exports[name]
+			if export.Replace != "" {
+				fmt.Printf("\t%v: %v %v%v\n", name, export.Type, export.Replace, overrides("exports:"+name, export.Pos))
+			} else {
+				fmt.Printf("\t%v: %v%v\n", name, export.Type, overrides("exports:"+name, export.Pos))
+			}
+		}
+	}
+}
+
+// Check configs (files or folders of them) against the schema, reporting every problem found
+//
+// Checks the configs of WHARF_CONFIG_PATH and the workspace config if none are given
+func configValidate(args []string) {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = base.ConfigSearchPath()
+		if len(paths) == 0 {
+			fmt.Println("no configs found in WHARF_CONFIG_PATH or the workspace, only the defaults are used")
+			return
+		}
+	}
+
+	valid := true
+	for _, path := range paths {
+		if err := base.ValidateConfig(path); err != nil {
+			valid = false
+			fmt.Println(err.Error())
+		} else {
+			fmt.Printf("%v: valid\n", path)
+		}
+	}
+
+	if !valid {
+		os.Exit(1)
+	}
+}
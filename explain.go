@@ -0,0 +1,110 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/zosopentools/wharf/internal/port2"
+)
+
+// Run the porting analysis and print the decisions made for a single package
+//
+// Usage: wharf explain [flags] <importpath> [packages]
+func explainMain(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	tagsFlag := fs.String("tags", "", "List of build tags")
+	goosFlag := fs.String("goos", "", "Platform to port to (defaults to 'go env GOOS')")
+	goarchFlag := fs.String("goarch", "", "Architecture to port to (defaults to 'go env GOARCH')")
+	var configFlag listFlag
+	fs.Var(&configFlag, "config", "Config for additional code edits (can be repeated)")
+	offlineFlag := fs.Bool("offline", false, "Never contact the network, only use the module cache and file:// proxies")
+	searchFlag := fs.String("search", "", "Search the versions of modules that need porting for one that builds as is (newest, closest, same-major)")
+	catalogFlag := fs.String("catalog", "", "Folder of patches for known module versions (defaults to the bundled deps-patches)")
+	stubsFlag := fs.Bool("stubs", false, "Generate stubs for missing definitions no inline directive covers")
+	verboseFlag := fs.Bool("v", false, "Enable verbose output")
+	jsonFlag := fs.Bool("json", false, "Print the trace as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		log.Fatal("no import path provided; see 'wharf --help' for usage")
+	}
+
+	importPath := fs.Arg(0)
+	paths := fs.Args()[1:]
+	if len(paths) == 0 {
+		paths = []string{importPath}
+	}
+
+	if *offlineFlag {
+		goOffline(false)
+	}
+
+	configure(*goosFlag, *goarchFlag, *tagsFlag, configFlag, *catalogFlag, *searchFlag, *stubsFlag)
+
+	wfWork := setupWorkspace(*verboseFlag)
+	ctx := port2.NewContext()
+	err := run(paths, ctx, true)
+	cleanupWorkspace(wfWork)
+
+	trace, ok := ctx.Trace(importPath)
+	if !ok {
+		if err != nil {
+			log.Println(err.Error())
+		}
+		log.Fatalf("%v was not loaded while porting %v\n", importPath, paths)
+	}
+
+	if *jsonFlag {
+		if outstrm, err := json.MarshalIndent(trace, "", "\t"); err == nil {
+			fmt.Println(string(outstrm))
+		} else {
+			log.Fatalln(err.Error())
+		}
+		return
+	}
+
+	printTrace(importPath, trace)
+}
+
+func printTrace(importPath string, trace *port2.Trace) {
+	fmt.Println("#", importPath)
+
+	if len(trace.Versions) > 0 {
+		fmt.Println("- module versions tried:")
+		for _, version := range trace.Versions {
+			fmt.Printf("\t%v\n", version)
+		}
+	}
+
+	if len(trace.Attempts) > 0 {
+		fmt.Println("- build configs tried:")
+		for _, attempt := range trace.Attempts {
+			if attempt.Rejected == "" {
+				fmt.Printf("\t%v: selected\n", attempt.Config)
+			} else {
+				fmt.Printf("\t%v: rejected, %v\n", attempt.Config, attempt.Rejected)
+			}
+			for _, err := range attempt.Errors {
+				fmt.Printf("\t\t%v\n", err)
+			}
+		}
+	}
+
+	if len(trace.Inlines) > 0 {
+		fmt.Println("- inline directives considered:")
+		for _, inline := range trace.Inlines {
+			fmt.Printf("\t%v\n", inline)
+		}
+	}
+
+	if trace.Result == "" {
+		fmt.Println("- result: package was not ported (no type errors or not built)")
+	} else {
+		fmt.Println("- result:", trace.Result)
+	}
+}
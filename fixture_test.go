@@ -0,0 +1,361 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"gopkg.in/yaml.v3"
+)
+
+var updateFixtures = flag.Bool("update", false, "rewrite the expected output of fixture tests")
+
+// A fixture: a workspace under testdata/fixtures/<name>/workspace and how wharf is run on it
+type Fixture struct {
+	Args  []string // Arguments to wharf, run from the workspace folder
+	Error string   // Wharf is expected to fail, with this in its errors
+	Files []string // Files expected to exist in the workspace afterwards
+	Build bool     // The workspace is expected to build for the target platform afterwards
+
+	// Wharf explain is run on the workspace afterwards, its output must contain Output
+	Explain struct {
+		Args   []string
+		Output string
+	}
+}
+
+// Port the synthetic modules of testdata/proxy, each exercising one porting path
+//
+// Modules are served from a file:// proxy built from testdata, so the tests never use the network
+func TestFixtures(t *testing.T) {
+	bin, err := os.Executable()
+	if err != nil {
+		t.Fatalf("unable to get test executable: %v", err)
+	}
+
+	proxy := t.TempDir()
+	if err := buildProxy(proxy, filepath.Join("testdata", "proxy")); err != nil {
+		t.Fatalf("unable to build module proxy: %v", err)
+	}
+	env := fixtureEnv(proxy, t.TempDir())
+
+	names, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*", "fixture.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		fixtureDir := filepath.Dir(name)
+		t.Run(filepath.Base(fixtureDir), func(t *testing.T) {
+			var fixture Fixture
+			if b, err := os.ReadFile(name); err != nil {
+				t.Fatalf("unable to read fixture: %v", err)
+			} else if err := yaml.Unmarshal(b, &fixture); err != nil {
+				t.Fatalf("unable to parse fixture: %v", err)
+			}
+
+			ws := t.TempDir()
+			if err := copyDir(ws, filepath.Join(fixtureDir, "workspace")); err != nil {
+				t.Fatalf("unable to copy workspace: %v", err)
+			}
+			if err := tidyModules(ws, env); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(bin, fixture.Args...)
+			cmd.Dir = ws
+			cmd.Env = append(env, WHARF_TEST_RUN+"=1")
+			var stdout bytes.Buffer
+			var stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			runErr := cmd.Run()
+
+			out := base.Output{}
+			if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+				t.Fatalf("unable to parse output: %v\n%v%v", err, stdout.String(), stderr.String())
+			}
+
+			if fixture.Error != "" {
+				if runErr == nil {
+					t.Fatalf("expected wharf to fail")
+				} else if !strings.Contains(out.Errors, fixture.Error) {
+					t.Fatalf("expected errors to contain %q, got:\n%v", fixture.Error, out.Errors)
+				}
+			} else if runErr != nil {
+				t.Fatalf("wharf failure: %v\n%v%v", runErr, out.Errors, stderr.String())
+			}
+
+			expectedPath := filepath.Join(fixtureDir, "expected.json")
+			if *updateFixtures {
+				// Folders are in temporary directories and not compared
+				for idx := range out.Modules {
+					out.Modules[idx].Dir = ""
+				}
+				for idx := range out.Packages {
+					out.Packages[idx].Dir = ""
+				}
+				expected, err := json.MarshalIndent(jsonOut{Modules: out.Modules, Packages: out.Packages, Offline: out.Offline}, "", "\t")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(expectedPath, append(expected, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var expect jsonOut
+			if b, err := os.ReadFile(expectedPath); err != nil {
+				t.Fatalf("unable to read expected output: %v", err)
+			} else if err := json.Unmarshal(b, &expect); err != nil {
+				t.Fatalf("unable to parse expected output: %v", err)
+			}
+			compareOutput(t, &expect, &out, true)
+
+			for _, file := range fixture.Files {
+				if _, err := os.Stat(filepath.Join(ws, filepath.FromSlash(file))); err != nil {
+					t.Errorf("expected file missing: %v", err)
+				}
+			}
+
+			if len(fixture.Explain.Args) > 0 {
+				cmd := exec.Command(bin, append([]string{"explain"}, fixture.Explain.Args...)...)
+				cmd.Dir = ws
+				cmd.Env = append(env, WHARF_TEST_RUN+"=1")
+				if output, err := cmd.CombinedOutput(); err != nil {
+					t.Errorf("wharf explain failure: %v\n%s", err, output)
+				} else if !strings.Contains(string(output), fixture.Explain.Output) {
+					t.Errorf("expected explanation to contain %q, got:\n%s", fixture.Explain.Output, output)
+				}
+			}
+
+			if fixture.Build {
+				goos, goarch := flagValue(fixture.Args, "goos"), flagValue(fixture.Args, "goarch")
+				cmd := exec.Command("go", "build", "./...")
+				cmd.Dir = filepath.Join(ws, "app")
+				cmd.Env = append(env, "GOOS="+goos, "GOARCH="+goarch)
+				if output, err := cmd.CombinedOutput(); err != nil {
+					t.Errorf("workspace does not build for %v/%v: %v\n%s", goos, goarch, err, output)
+				}
+			}
+		})
+	}
+}
+
+// Compare the pins and patches wharf made against the expected ones, ignoring their order
+//
+// The updates of the live modules used by TestModules move on, so only the fixtures compare the versions pinned with exactPins
+func compareOutput(t *testing.T, expect *jsonOut, out *base.Output, exactPins bool) {
+	t.Helper()
+
+	if len(expect.Modules) != len(out.Modules) {
+		t.Fatalf("expected %v pinned modules, got %v", len(expect.Modules), len(out.Modules))
+	}
+	moduleSet := make(map[string]*base.ModulePin, len(expect.Modules))
+	for i := range expect.Modules {
+		mod := &expect.Modules[i]
+		moduleSet[mod.Path] = mod
+	}
+	for _, oMod := range out.Modules {
+		if eMod, ok := moduleSet[oMod.Path]; !ok {
+			t.Errorf("unexpected pinned module: %v", oMod.Path)
+		} else if !compareModules(eMod, &oMod, exactPins) {
+			t.Errorf("incorrect pinning: %v (got %v@%v imported %v redirect %q)", eMod.Path, oMod.Version, oMod.Pinned, oMod.Imported, oMod.Redirect)
+		}
+	}
+
+	if strings.Join(expect.Offline, "\n") != strings.Join(out.Offline, "\n") {
+		t.Errorf("expected offline notes %q, got %q", expect.Offline, out.Offline)
+	}
+
+	if len(expect.Packages) != len(out.Packages) {
+		t.Fatalf("expected %v patched packages, got %v", len(expect.Packages), len(out.Packages))
+	}
+	packageSet := make(map[string]*base.PackagePatch, len(expect.Packages))
+	for i := range expect.Packages {
+		pkg := &expect.Packages[i]
+		packageSet[pkg.Path] = pkg
+	}
+	for _, oPkg := range out.Packages {
+		if ePkg, ok := packageSet[oPkg.Path]; !ok {
+			t.Errorf("unexpected patched package: %v", oPkg.Path)
+		} else if !comparePackages(ePkg, &oPkg) {
+			t.Errorf("incorrect patch: %v", ePkg.Path)
+		}
+	}
+}
+
+// Variables that are replaced to keep go and wharf away from the network and the user's setup
+var fixtureEnvKeys = map[string]bool{
+	"GOFLAGS": true, "GOWORK": true, "GOOS": true, "GOARCH": true, "GOMODCACHE": true,
+	"GOPROXY": true, "GONOPROXY": true, "GOPRIVATE": true, "GOSUMDB": true, "GONOSUMDB": true,
+	"GOVCS": true, "GOTOOLCHAIN": true, "WHARF_CONFIG_PATH": true,
+}
+
+// Environment that only uses the proxy built from testdata and a private module cache
+func fixtureEnv(proxy string, modcache string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !fixtureEnvKeys[kv[:strings.Index(kv, "=")]] {
+			env = append(env, kv)
+		}
+	}
+	return append(env,
+		"GOPROXY=file://"+filepath.ToSlash(proxy),
+		"GOMODCACHE="+modcache,
+		"GOFLAGS=-modcacherw",
+		"GOSUMDB=off",
+		"GOVCS=*:off",
+		"GOTOOLCHAIN=local",
+	)
+}
+
+// Build a file:// module proxy from folders named <module path>@<version>
+//
+// Module paths are lower case, so they don't need escaping
+func buildProxy(proxy string, src string) error {
+	versions := make(map[string][]string)
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || !strings.Contains(d.Name(), "@") {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		idx := strings.LastIndex(rel, "@")
+		modPath, version := filepath.ToSlash(rel[:idx]), rel[idx+1:]
+		versions[modPath] = append(versions[modPath], version)
+
+		dst := filepath.Join(proxy, filepath.FromSlash(modPath), "@v")
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		if err := zipModule(filepath.Join(dst, version+".zip"), path, modPath+"@"+version); err != nil {
+			return err
+		}
+		mod, err := os.ReadFile(filepath.Join(path, "go.mod"))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dst, version+".mod"), mod, 0644); err != nil {
+			return err
+		}
+		info := fmt.Sprintf(`{"Version":%q,"Time":"2023-01-01T00:00:00Z"}`, version)
+		if err := os.WriteFile(filepath.Join(dst, version+".info"), []byte(info), 0644); err != nil {
+			return err
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return err
+	}
+
+	for modPath, list := range versions {
+		sort.Strings(list)
+		list := strings.Join(list, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(proxy, filepath.FromSlash(modPath), "@v", "list"), []byte(list), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Zip the files of a module folder, prefixed by module@version as the go command expects
+func zipModule(dst string, dir string, prefix string) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(prefix + "/" + filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, buf.Bytes(), 0644)
+}
+
+// Copy a folder recursively
+func copyDir(dst string, src string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, b, 0644)
+	})
+}
+
+// Write the go.sum files of the workspace modules, which are left out of testdata
+func tidyModules(ws string, env []string) error {
+	mods, err := filepath.Glob(filepath.Join(ws, "*", "go.mod"))
+	if err != nil {
+		return err
+	}
+	for _, mod := range mods {
+		cmd := exec.Command("go", "mod", "tidy")
+		cmd.Dir = filepath.Dir(mod)
+		cmd.Env = append(env, "GOWORK=off")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("go mod tidy in %v: %v\n%s", filepath.Dir(mod), err, output)
+		}
+	}
+	return nil
+}
+
+// Value of a -name flag in a list of arguments
+func flagValue(args []string, name string) string {
+	for idx, arg := range args {
+		if arg == "-"+name && idx+1 < len(args) {
+			return args[idx+1]
+		}
+		if value := strings.TrimPrefix(arg, "-"+name+"="); value != arg {
+			return value
+		}
+	}
+	return ""
+}
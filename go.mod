@@ -5,6 +5,7 @@ module github.com/zosopentools/wharf
 go 1.18
 
 require (
+	golang.org/x/mod v0.9.0
 	golang.org/x/tools v0.7.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -5,34 +5,116 @@ package main
 var helpText = `
 The wharf command builds packages
 making changes to the target package and any dependencies
-so that the package can successfully build on IBM z/OS.
-Outputs actions taken to 'gozos-port.log'.
+so that the package can successfully build on IBM z/OS
+(or on another unix-like platform selected with -goos).
+Outputs actions taken to 'gozos-port.log' in the workspace folder.
 
 To run, working directory must be inside a Go workspace.
 
 Usage:
 	wharf [flags] <package>
+	wharf plan [-goos] [-goarch] [-tags] [-config] [-catalog] [-search] [-offline] [-stubs] [-native] [-o <file>] <package>
+	wharf apply [-q] [-p] [-d] [-f] [-offline] <plan>
+	wharf explain [-goos] [-goarch] [-tags] [-config] [-catalog] [-search] [-offline] [-stubs] [-json] <importpath> [packages]
+	wharf revert [-f]
+	wharf status [-json]
+	wharf config show [-config] [-json] [packages]
+	wharf config validate [files]
+	wharf patches list [-catalog]
+	wharf patches check [-catalog] [-offline] [module[@version]...]
+
+Commands:
+plan
+	Run the porting analysis and save the changes Wharf intends to make
+	(module pins, package patches and generated files) to a plan file,
+	without touching the workspace
+apply
+	Apply a plan saved by 'wharf plan'; refuses to run if the workspace
+	or the module versions have changed since the plan was computed
+explain
+	Run the porting analysis on the given packages (defaults to <importpath>)
+	and print what was tried for <importpath>: module versions, build configs
+	and the type errors each produced, why configs were rejected and which
+	inline directives were considered
+revert
+	Undo the last run that applied changes: restores the files it edited and
+	the workspace file, deletes the files it generated and removes the modules
+	it imported; refuses to run if those files were changed since, unless -f is set
+status
+	Scan the workspace modules for changes left by Wharf and report the
+	imported modules, and the packages and files carrying Wharf notices
+	(with the original of each generated file)
+config show
+	Print the inline directives of every config layer (the defaults, the configs
+	in WHARF_CONFIG_PATH, the workspace wharf.yaml, then each -config file), with
+	the location of each directive and the ones it overrides; later layers take precedence
+config validate
+	Check configs or folders of configs (defaults to the ones in WHARF_CONFIG_PATH
+	and the workspace wharf.yaml) against the schema and report every problem found,
+	with its line number
+patches list
+	Print the patches of the catalog with their subject and the files they change
+patches check
+	Apply the catalog patches of the given modules (defaults to every module in the
+	build list of the workspace that has one) to a fresh copy of the module, and report
+	the ones that no longer apply cleanly
 
 Options:
 -help
 	Display this message
 -n
-	Don't make changes, just print out suggested actions, cannot run with -t
+	Don't make changes, just print out suggested actions and the unified diff
+	of every file that would be written, cannot run with -t
 -v
-	Verbose output (will still get logged to output file)
+	Verbose output, also prints the action log to stderr (will still get logged to output file)
 -t
 	Run tests on the package after successful build, cannot run with -n
 -q <path>
 	Clones dependencies from VCS instead of copying from module cache
 -p
-	REQUIRES -q
-	Automatically create and save patch files (diffs)
+	Save a patch file (git format-patch style) per imported module to the workspace folder,
+	named <repo>--<version>.patch like the files in deps-patches
+-goos
+	Platform to port the package to (defaults to 'go env GOOS'), eg. zos, aix,
+	solaris or illumos; GOARCH is changed to one supported by the platform if needed
+-goarch
+	Architecture to port the package to (defaults to 'go env GOARCH');
+	files and build constraints for other architectures are treated as not built
 -config
-	Path to config for additional code edits
+	Path to config for additional code edits, or to a folder of them (every *.yaml
+	file in it), can be repeated; layered over the defaults, the configs found in
+	WHARF_CONFIG_PATH (a list of files and folders, separated like PATH) and the
+	wharf.yaml file in the workspace folder (if any)
+-catalog
+	Folder of patches for known module versions, named <repo>--<version>.patch like the
+	files in deps-patches; a module at a version with a patch is imported with the patch
+	applied before it is type checked (defaults to the bundled deps-patches when porting to zos);
+	a patch only applies to the module modules.yaml in the folder maps its name to, or else
+	to the module@version in its subject
+-search
+	Search the released versions of a module that needs porting (listed by GOPROXY, or
+	found in the module cache) for one that type checks as is, instead of only trying the
+	update: newest tries the newest version first, closest the one closest to the version
+	selected by MVS; add same-major (eg. -search newest,same-major) to never change the
+	major version. Falls back to the version selected by MVS if none builds
+-offline
+	Never contact the network: modules are only fetched from the module cache and the file://
+	proxies of GOPROXY, checksum database lookups are turned off and cloning from VCS (-q) is refused;
+	the decisions limited by offline mode (eg. updates only found among downloaded versions) are reported
+-stubs
+	Generate stubs (returning syscall.ENOSYS, or panicking) for functions and variables that are
+	missing on the platform and that no inline directive covers (off by default, stubs that panic
+	are reported as warnings)
+-native
+	Download the newer released versions of each imported module and report the oldest one
+	where every ported package already has files built for the platform, so the module can
+	be upgraded instead of imported (off by default)
 -d
 	Filesystem pat to store imported modules
 -f
 	Force apply changes
+-json
+	Print the porting results (modules, packages, errors) as JSON on stdout
 -version
 	Display version information
 `
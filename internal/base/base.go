@@ -10,7 +10,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
+	"github.com/zosopentools/wharf/internal/tags"
 	"github.com/zosopentools/wharf/internal/util"
 )
 
@@ -50,6 +52,9 @@ func initGoEnv() {
 		vnum -= 1
 	}
 
+	// Ports to the host GOOS by default (see SetPlatform)
+	tags.SetTarget(goenv["GOOS"])
+
 	// Initialize some variables here to default values (can be overwritten)
 	goWorkDir := filepath.Dir(GOWORK())
 	Cache = filepath.Join(goWorkDir, ".wharf_cache") // TODO: move this to TMPDIR
@@ -59,12 +64,180 @@ func initGoEnv() {
 	ImportDir = filepath.Join(goWorkDir, "wharf_port")
 }
 
+// File in the workspace folder that Wharf records its actions to
+const LOG_FILE = "gozos-port.log"
+
+// File in the workspace folder that records the changes made by each run, used by 'wharf revert'
+const MANIFEST_FILE = ".wharf_manifest.json"
+
 var goenv = make(map[string]string)
 var BuildTags = make(map[string]bool)
 
+// Generate stubs for the missing definitions of imported packages that no inline directive covers
+var Stubs = false
+
+// Download newer versions of imported modules to find one that already builds on the platform
+var FindNative = false
+
+// Strategies to search the versions of a module for one that type checks without edits
+const (
+	// Try the newest version first
+	VERSION_SEARCH_NEWEST = "newest"
+
+	// Try the version closest to the one selected by MVS first
+	VERSION_SEARCH_CLOSEST = "closest"
+
+	// Only try versions of the major version selected by MVS (combined with a strategy)
+	VERSION_SEARCH_SAME_MAJOR = "same-major"
+)
+
+// Strategy used to search the versions of a module that needs porting (see SetVersionSearch),
+// if empty only the update reported by 'go list -m -u' is tried
+var VersionSearch string
+
+// Never search versions of another major version than the one selected by MVS
+var SameMajor bool
+
+// Never contact the network, modules are only fetched from the module cache and file:// proxies (see SetOffline)
+var Offline bool
+
+// Decisions that were limited by offline mode, as reported to the user
+var OfflineNotes []string
+
 var ImportDir string
 var Cache string
 
+// Set the version search from a comma separated list of options (eg. "newest,same-major")
+//
+// The newest version is tried first if no strategy is given
+func SetVersionSearch(spec string) error {
+	VersionSearch, SameMajor = "", false
+	if spec == "" {
+		return nil
+	}
+
+	for _, option := range strings.Split(spec, ",") {
+		switch option = strings.TrimSpace(option); option {
+		case VERSION_SEARCH_NEWEST, VERSION_SEARCH_CLOSEST:
+			if VersionSearch != "" && VersionSearch != option {
+				return fmt.Errorf("version search strategies %v and %v can't be combined", VersionSearch, option)
+			}
+			VersionSearch = option
+		case VERSION_SEARCH_SAME_MAJOR:
+			SameMajor = true
+		default:
+			return fmt.Errorf("unknown version search option %q (expected %v, %v or %v)",
+				option, VERSION_SEARCH_NEWEST, VERSION_SEARCH_CLOSEST, VERSION_SEARCH_SAME_MAJOR)
+		}
+	}
+
+	if VersionSearch == "" {
+		VersionSearch = VERSION_SEARCH_NEWEST
+	}
+	return nil
+}
+
+// Change the platform packages are ported to (defaults to 'go env GOOS' and 'go env GOARCH')
+//
+// An empty goos keeps the current one. An empty goarch keeps the current one if the
+// platform supports it, otherwise one that it supports is picked.
+// The Go environment and build tags are reloaded to match
+func SetPlatform(goos string, goarch string) error {
+	if goos == "" {
+		goos = GOOS()
+	}
+	if goos == GOOS() && (goarch == "" || goarch == GOARCH()) {
+		return tags.SetTarget(goos)
+	}
+
+	ports, err := util.GoToolDistList()
+	if err != nil {
+		return err
+	}
+
+	supported := ""
+	for _, port := range ports {
+		if port.GOOS != goos {
+			continue
+		}
+		if port.GOARCH == goarch || (goarch == "" && port.GOARCH == GOARCH()) {
+			supported = port.GOARCH
+			break
+		}
+		if goarch == "" && supported == "" {
+			supported = port.GOARCH
+		}
+	}
+
+	if supported == "" {
+		if goarch != "" {
+			return fmt.Errorf("%v/%v is not supported by this Go toolchain (see 'go tool dist list')", goos, goarch)
+		}
+		return fmt.Errorf("GOOS %v is not supported by this Go toolchain (see 'go tool dist list')", goos)
+	}
+
+	if err := tags.SetTarget(goos); err != nil {
+		return err
+	}
+
+	if err := os.Setenv("GOOS", goos); err != nil {
+		return err
+	}
+	if err := os.Setenv("GOARCH", supported); err != nil {
+		return err
+	}
+
+	BuildTags = make(map[string]bool)
+	initGoEnv()
+	return nil
+}
+
+// Keep the go command from reaching the network
+//
+// GOPROXY is limited to its file:// proxies and the download folder of the module cache (which is laid out
+// like a proxy), so updates and other versions are still found if they were downloaded before.
+// Checksum database lookups, VCS access and toolchain downloads are turned off
+func SetOffline() error {
+	var proxies []string
+	for _, proxy := range strings.FieldsFunc(goenv["GOPROXY"], func(r rune) bool { return r == ',' || r == '|' }) {
+		if strings.HasPrefix(proxy, "file://") {
+			proxies = append(proxies, proxy)
+		}
+	}
+	proxies = append(proxies, "file://"+filepath.ToSlash(filepath.Join(goenv["GOMODCACHE"], "cache", "download")))
+
+	env := map[string]string{
+		"GOPROXY":     strings.Join(proxies, ","),
+		"GOSUMDB":     "off",
+		"GOVCS":       "*:off",
+		"GOTOOLCHAIN": "local",
+	}
+	for key, value := range env {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+		goenv[key] = value
+	}
+
+	Offline = true
+	return nil
+}
+
+// Record a decision that was limited by offline mode (does nothing when online)
+func NoteOffline(format string, args ...interface{}) {
+	if !Offline {
+		return
+	}
+
+	note := fmt.Sprintf(format, args...)
+	for _, prev := range OfflineNotes {
+		if prev == note {
+			return
+		}
+	}
+	OfflineNotes = append(OfflineNotes, note)
+}
+
 func GOOS() string {
 	return goenv["GOOS"]
 }
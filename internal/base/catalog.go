@@ -0,0 +1,98 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package base
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/zosopentools/wharf/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Catalog of patches for known module versions, applied when a module at one of these versions is ported
+//
+// Patches are named <repo>--<version>.patch like the files in deps-patches (see util.PatchFileName),
+// nil if no catalog is used
+var PatchCatalog fs.FS
+
+// Folder the catalog was loaded from, as reported to the user
+var PatchCatalogName string
+
+// Index of the catalog, mapping the name of each patch to the path of the module it is for
+const CATALOG_INDEX = "modules.yaml"
+
+// Find the catalog patch of a module version
+//
+// Patch names only hold the base name of the repository, so a patch is only returned if the catalog
+// index (or the module@version in its subject) names the module; a patch for another module is an error
+func CatalogPatch(modPath string, version string) (name string, diff []byte, err error) {
+	if PatchCatalog == nil {
+		return "", nil, nil
+	}
+	name = util.PatchFileName(modPath, version)
+	diff, err = fs.ReadFile(PatchCatalog, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	patchMod, err := CatalogPatchModule(name, diff)
+	if err != nil {
+		return "", nil, err
+	} else if patchMod == "" {
+		return "", nil, fmt.Errorf("catalog patch %v does not name its module (add it to %v)", name, CATALOG_INDEX)
+	} else if patchMod != modPath {
+		return "", nil, fmt.Errorf("catalog patch %v is for %v, not %v", name, patchMod, modPath)
+	}
+	return name, diff, nil
+}
+
+// Path of the module a catalog patch is for, from the catalog index or else a module@version in the subject of the patch
+//
+// Empty if neither names the module
+func CatalogPatchModule(name string, diff []byte) (string, error) {
+	index, err := fs.ReadFile(PatchCatalog, CATALOG_INDEX)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if len(index) > 0 {
+		modules := make(map[string]string)
+		if err := yaml.Unmarshal(index, &modules); err != nil {
+			return "", fmt.Errorf("unable to parse %v: %w", CATALOG_INDEX, err)
+		}
+		if modPath, ok := modules[name]; ok {
+			return modPath, nil
+		}
+	}
+
+	for _, field := range strings.Fields(util.PatchSubject(diff)) {
+		if modPath, _, found := strings.Cut(field, "@"); found && strings.Contains(modPath, "/") {
+			return modPath, nil
+		}
+	}
+	return "", nil
+}
+
+// Read a patch of the catalog by name
+func ReadCatalogPatch(name string) ([]byte, error) {
+	if PatchCatalog == nil {
+		return nil, errors.New("no patch catalog is used")
+	}
+	return fs.ReadFile(PatchCatalog, name)
+}
+
+// Names of every patch in the catalog, sorted
+func CatalogPatches() ([]string, error) {
+	if PatchCatalog == nil {
+		return nil, nil
+	}
+	names, err := fs.Glob(PatchCatalog, "*.patch")
+	sort.Strings(names)
+	return names, err
+}
@@ -0,0 +1,63 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package base
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testCatalogPatch = `From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: Wharf <wharf@example.com>
+Date: Sun, 1 Jan 2023 00:00:00 +0000
+Subject: [PATCH] %v
+
+---
+diff --git a/pty_zos.go b/pty_zos.go
+new file mode 100644
+--- /dev/null
++++ b/pty_zos.go
+@@ -0,0 +1 @@
++package pty
+`
+
+func TestCatalogPatch(t *testing.T) {
+	defer func() { PatchCatalog = nil }()
+	PatchCatalog = fstest.MapFS{
+		CATALOG_INDEX:             {Data: []byte("pty--v1.1.21.patch: github.com/creack/pty\n")},
+		"pty--v1.1.21.patch":      {Data: []byte(strings.Replace(testCatalogPatch, "%v", "Add zOS support", 1))},
+		"pty--v1.1.20.patch":      {Data: []byte(strings.Replace(testCatalogPatch, "%v", "Add zos support to github.com/creack/pty@v1.1.20", 1))},
+		"machineid--v1.0.1.patch": {Data: []byte(strings.Replace(testCatalogPatch, "%v", "Add zOS support", 1))},
+	}
+
+	cases := []struct {
+		module   string
+		version  string
+		name     string
+		expected string // Error
+	}{
+		{"github.com/creack/pty", "v1.1.21", "pty--v1.1.21.patch", ""},
+		{"github.com/creack/pty", "v1.1.20", "pty--v1.1.20.patch", ""},
+		// Same repository name, other owner
+		{"github.com/other/pty", "v1.1.21", "", "is for github.com/creack/pty, not github.com/other/pty"},
+		{"github.com/other/pty", "v1.1.20", "", "is for github.com/creack/pty, not github.com/other/pty"},
+		{"github.com/denisbrodbeck/machineid", "v1.0.1", "", "does not name its module"},
+		{"github.com/creack/pty", "v1.1.19", "", ""},
+	}
+	for _, tc := range cases {
+		name, diff, err := CatalogPatch(tc.module, tc.version)
+		if tc.expected != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("%v@%v: expected error %q, got %v", tc.module, tc.version, tc.expected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v@%v: %v", tc.module, tc.version, err)
+		} else if name != tc.name || (name != "") != (diff != nil) {
+			t.Errorf("%v@%v: expected patch %q, got %q", tc.module, tc.version, tc.name, name)
+		}
+	}
+}
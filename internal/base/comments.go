@@ -1,9 +1,27 @@
 package base
 
+import "strings"
+
 // Comments added to files that are altered by Wharf
 const (
 	TAG_NOTICE     = "Tags altered by Wharf (added %v)"
 	FILE_NOTICE    = "This file was generated by Wharf (original %v)"
+	DIFF_NOTICE    = "This file was generated by Wharf (patched with %v)"
+	STUB_NOTICE    = "This file was generated by Wharf (stubs of definitions missing on %v)"
 	USE_NOTICE     = "Imported by Wharf (version %v)"
 	REPLACE_NOTICE = "Added by Wharf"
 )
+
+// Match a comment against a notice, returning the value filled into it (if any)
+func ParseNotice(notice string, comment string) (string, bool) {
+	comment = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), "//"))
+	prefix, suffix, ok := strings.Cut(notice, "%v")
+	if !ok {
+		return "", comment == notice
+	}
+
+	if len(comment) < len(prefix)+len(suffix) || !strings.HasPrefix(comment, prefix) || !strings.HasSuffix(comment, suffix) {
+		return "", false
+	}
+	return comment[len(prefix) : len(comment)-len(suffix)], true
+}
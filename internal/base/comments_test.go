@@ -0,0 +1,36 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package base
+
+import "testing"
+
+func TestParseNotice(t *testing.T) {
+	cases := []struct {
+		notice  string
+		comment string
+		value   string
+		ok      bool
+	}{
+		{TAG_NOTICE, "// Tags altered by Wharf (added zos)", "zos", true},
+		// Line of a block comment
+		{TAG_NOTICE, "  Tags altered by Wharf (added zos)\t", "zos", true},
+		{TAG_NOTICE, "// Tags altered by Wharf", "", false},
+		{TAG_NOTICE, "// This file was generated by Wharf (original term_linux.go)", "", false},
+		{FILE_NOTICE, "// This file was generated by Wharf (original term_linux.go)", "term_linux.go", true},
+		{FILE_NOTICE, "//This file was generated by Wharf (original term_linux.go)", "term_linux.go", true},
+		{DIFF_NOTICE, "// This file was generated by Wharf (patched with term.patch)", "term.patch", true},
+		{DIFF_NOTICE, "// This file was generated by Wharf (original term_linux.go)", "", false},
+		{STUB_NOTICE, "// This file was generated by Wharf (stubs of definitions missing on zos)", "zos", true},
+		{USE_NOTICE, "// Imported by Wharf (version v1.0.0)", "v1.0.0", true},
+		{REPLACE_NOTICE, "// Added by Wharf", "", true},
+		{REPLACE_NOTICE, "// Added by Wharf (version v1.0.0)", "", false},
+	}
+
+	for _, tc := range cases {
+		value, ok := ParseNotice(tc.notice, tc.comment)
+		if value != tc.value || ok != tc.ok {
+			t.Errorf("%q: %q: expected %q %v, got %q %v", tc.notice, tc.comment, tc.value, tc.ok, value, ok)
+		}
+	}
+}
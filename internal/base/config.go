@@ -0,0 +1,272 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package base
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zosopentools/wharf/internal/util"
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Where a directive was loaded from
+type Location struct {
+	File string
+	Line int
+}
+
+func (loc Location) String() string {
+	return fmt.Sprintf("%v:%v", loc.File, loc.Line)
+}
+
+// A problem found in a config file
+type ConfigError struct {
+	Pos Location
+	Msg string
+}
+
+func (err ConfigError) Error() string {
+	return fmt.Sprintf("%v: %v", err.Pos, err.Msg)
+}
+
+// Every problem found in a config file
+type ConfigErrors []ConfigError
+
+func (errs ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Parse and validate the directives of a config, in the order they are written
+//
+// A package is either given a single entry or a list of entries (eg. for different versions).
+// Relative paths of file directives are resolved against dir (unless it is empty).
+// Returns ConfigErrors if the config doesn't follow the schema
+func ParseConfig(data []byte, file string, dir string) ([]*PackageInline, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%v: %w", file, err)
+	}
+
+	parser := configParser{file: file, dir: dir}
+	spec := parser.parse(&doc)
+	if len(parser.errs) > 0 {
+		return nil, parser.errs
+	}
+	return spec, nil
+}
+
+type configParser struct {
+	file string
+	dir  string
+	errs ConfigErrors
+}
+
+func (parser *configParser) pos(node *yaml.Node) Location {
+	return Location{File: parser.file, Line: node.Line}
+}
+
+func (parser *configParser) errorf(node *yaml.Node, format string, args ...interface{}) {
+	parser.errs = append(parser.errs, ConfigError{Pos: parser.pos(node), Msg: fmt.Sprintf(format, args...)})
+}
+
+// Walk the pairs of a mapping, reporting duplicate keys
+func (parser *configParser) mapping(node *yaml.Node, what string, visit func(key string, keyNode, value *yaml.Node)) {
+	if node.Kind != yaml.MappingNode {
+		parser.errorf(node, "%v must be a mapping", what)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		key, value := node.Content[idx], node.Content[idx+1]
+		if key.Kind != yaml.ScalarNode {
+			parser.errorf(key, "keys of %v must be strings", what)
+			continue
+		}
+		if seen[key.Value] {
+			parser.errorf(key, "%v is defined more than once in %v", key.Value, what)
+			continue
+		}
+		seen[key.Value] = true
+		visit(key.Value, key, value)
+	}
+}
+
+// Value of a field that has to be a (non empty) string
+func (parser *configParser) scalar(node *yaml.Node, field string) string {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" || node.Value == "" {
+		parser.errorf(node, "%v must be a non empty string", field)
+		return ""
+	}
+	return node.Value
+}
+
+func (parser *configParser) parse(doc *yaml.Node) []*PackageInline {
+	// An empty file has no directives
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return nil
+	}
+
+	var spec []*PackageInline
+	parser.mapping(doc.Content[0], "the config", func(pkgname string, _, value *yaml.Node) {
+		switch value.Kind {
+		case yaml.SequenceNode:
+			for _, entry := range value.Content {
+				if pkgSpec := parser.packageEntry(pkgname, entry); pkgSpec != nil {
+					spec = append(spec, pkgSpec)
+				}
+			}
+		case yaml.MappingNode:
+			if pkgSpec := parser.packageEntry(pkgname, value); pkgSpec != nil {
+				spec = append(spec, pkgSpec)
+			}
+		default:
+			if value.Tag != "!!null" {
+				parser.errorf(value, "directives of %v must be a mapping or a list of mappings", pkgname)
+			}
+		}
+	})
+	return spec
+}
+
+func (parser *configParser) packageEntry(pkgname string, node *yaml.Node) *PackageInline {
+	pkgSpec := &PackageInline{Package: pkgname, Pos: parser.pos(node)}
+	errCount := len(parser.errs)
+
+	parser.mapping(node, "directives of "+pkgname, func(key string, keyNode, value *yaml.Node) {
+		switch key {
+		case "versions":
+			pkgSpec.Versions = parser.scalar(value, "versions")
+			if _, err := util.MatchVersion(pkgSpec.Versions, ""); pkgSpec.Versions != "" && err != nil {
+				parser.errorf(value, "%v", err)
+			}
+		case "files":
+			pkgSpec.Files = make(map[string]FileInline)
+			parser.mapping(value, "files of "+pkgname, func(name string, keyNode, value *yaml.Node) {
+				if fileSpec, ok := parser.fileDirective(name, keyNode, value); ok {
+					pkgSpec.Files[name] = fileSpec
+				}
+			})
+		case "exports":
+			pkgSpec.Exports = make(map[string]ExportInline)
+			parser.mapping(value, "exports of "+pkgname, func(name string, keyNode, value *yaml.Node) {
+				if expSpec, ok := parser.exportDirective(name, keyNode, value); ok {
+					pkgSpec.Exports[name] = expSpec
+				}
+			})
+		case "redirect":
+			pkgSpec.Redirect = parser.redirectDirective(pkgname, keyNode, value)
+		default:
+			parser.errorf(keyNode, "unknown field %v in directives of %v (expected versions, files, exports or redirect)", key, pkgname)
+		}
+	})
+
+	if len(parser.errs) > errCount {
+		return nil
+	}
+	return pkgSpec
+}
+
+// Fields of a directive, reporting the unknown ones
+func (parser *configParser) fields(node *yaml.Node, what string, known ...string) map[string]*yaml.Node {
+	fields := make(map[string]*yaml.Node)
+	parser.mapping(node, what, func(key string, keyNode, value *yaml.Node) {
+		for _, name := range known {
+			if key == name {
+				fields[key] = value
+				return
+			}
+		}
+		parser.errorf(keyNode, "unknown field %v in %v (expected %v)", key, what, strings.Join(known, " or "))
+	})
+	return fields
+}
+
+func (parser *configParser) fileDirective(name string, keyNode, node *yaml.Node) (fileSpec FileInline, ok bool) {
+	errCount := len(parser.errs)
+	fileSpec.Pos = parser.pos(keyNode)
+
+	fields := parser.fields(node, "file directive "+name, "type", "path")
+	if value := fields["type"]; value == nil {
+		parser.errorf(node, "file directive %v has no type", name)
+	} else if fileSpec.Type = parser.scalar(value, "type"); fileSpec.Type != InlineDiffSym && fileSpec.Type != "" {
+		parser.errorf(value, "unknown file directive type %v (expected %v)", fileSpec.Type, InlineDiffSym)
+	}
+
+	if value := fields["path"]; value == nil {
+		parser.errorf(node, "file directive %v has no path", name)
+	} else if fileSpec.Path = parser.scalar(value, "path"); fileSpec.Path != "" {
+		if parser.dir != "" {
+			fileSpec.Path = util.ResolvePath(parser.dir, fileSpec.Path)
+		}
+		if _, err := util.Stat(fileSpec.Path); err != nil {
+			parser.errorf(value, "unable to find diff of file directive %v: %v", name, err)
+		}
+	}
+
+	return fileSpec, len(parser.errs) == errCount
+}
+
+func (parser *configParser) exportDirective(name string, keyNode, node *yaml.Node) (expSpec ExportInline, ok bool) {
+	errCount := len(parser.errs)
+	expSpec.Pos = parser.pos(keyNode)
+
+	fields := parser.fields(node, "export directive "+name, "type", "replace")
+	if value := fields["replace"]; value != nil {
+		expSpec.Replace = parser.scalar(value, "replace")
+	}
+
+	value := fields["type"]
+	if value == nil {
+		parser.errorf(node, "export directive %v has no type", name)
+		return expSpec, false
+	}
+	switch expSpec.Type = parser.scalar(value, "type"); expSpec.Type {
+	case InlineExportSym, InlineConstSym:
+		if expSpec.Replace == "" {
+			parser.errorf(node, "%v directive %v has no replacement", expSpec.Type, name)
+		}
+	case InlineConvertSym, InlineStubSym:
+		if fields["replace"] != nil {
+			parser.errorf(fields["replace"], "%v directive %v does not take a replacement", expSpec.Type, name)
+		}
+	case "":
+	default:
+		parser.errorf(value, "unknown export directive type %v (expected %v, %v, %v or %v)",
+			expSpec.Type, InlineExportSym, InlineConstSym, InlineConvertSym, InlineStubSym)
+	}
+
+	return expSpec, len(parser.errs) == errCount
+}
+
+func (parser *configParser) redirectDirective(pkgname string, keyNode, node *yaml.Node) *RedirectInline {
+	errCount := len(parser.errs)
+	redirect := &RedirectInline{Pos: parser.pos(keyNode)}
+
+	fields := parser.fields(node, "redirect of "+pkgname, "path", "version")
+	if value := fields["path"]; value == nil {
+		parser.errorf(node, "redirect of %v has no path", pkgname)
+	} else {
+		redirect.Path = parser.scalar(value, "path")
+	}
+
+	if value := fields["version"]; value == nil {
+		parser.errorf(node, "redirect of %v has no version", pkgname)
+	} else if redirect.Version = parser.scalar(value, "version"); redirect.Version != "" {
+		if !semver.IsValid(redirect.Version) {
+			parser.errorf(value, "invalid version %q", redirect.Version)
+		}
+	}
+
+	if len(parser.errs) > errCount {
+		return nil
+	}
+	return redirect
+}
@@ -0,0 +1,165 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `syscall:
+  exports:
+    EBADFD:
+      type: EXPORT
+      replace: EBADF
+
+golang.org/x/sys/unix:
+  - versions: "<v0.15.0"
+    exports:
+      MAP_ANON:
+        type: CONST
+        replace: 0x0
+  - versions: ">=v0.15.0"
+    exports:
+      MAP_ANON:
+        type: STUB
+
+github.com/creack/pty:
+  redirect:
+    path: example.com/pty
+    version: v1.1.21-zos
+`
+
+const testBadConfig = `syscall:
+  exports:
+    EBADFD:
+      type: EXPROT
+      replace: EBADF
+    Nlink:
+      type: CONVERT
+      replace: uint64
+    MAP_ANON:
+      type: CONST
+  files:
+    errs.go:
+      type: DIFF
+  colour: red
+
+golang.org/x/sys/unix:
+  - versions: "<0.15"
+  - exports: []
+`
+
+func TestParseConfig(t *testing.T) {
+	spec, err := ParseConfig([]byte(testConfig), "test.yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec) != 4 {
+		t.Fatalf("expected 4 entries, got %v", len(spec))
+	}
+
+	if ed := spec[0].Exports["EBADFD"]; ed.Type != InlineExportSym || ed.Replace != "EBADF" || ed.Pos.Line != 3 {
+		t.Errorf("unexpected EBADFD directive: %+v", ed)
+	}
+	if spec[1].Package != "golang.org/x/sys/unix" || spec[1].Versions != "<v0.15.0" || spec[2].Versions != ">=v0.15.0" {
+		t.Errorf("unexpected version entries: %+v, %+v", spec[1], spec[2])
+	}
+	if redirect := spec[3].Redirect; redirect == nil || redirect.Path != "example.com/pty" || redirect.Version != "v1.1.21-zos" {
+		t.Errorf("unexpected redirect: %+v", redirect)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	_, err := ParseConfig([]byte(testBadConfig), "bad.yaml", "")
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("expected config errors, got %v", err)
+	}
+
+	expected := []string{
+		"bad.yaml:4: unknown export directive type EXPROT (expected EXPORT, CONST, CONVERT or STUB)",
+		"bad.yaml:8: CONVERT directive Nlink does not take a replacement",
+		"bad.yaml:10: CONST directive MAP_ANON has no replacement",
+		"bad.yaml:13: file directive errs.go has no path",
+		"bad.yaml:14: unknown field colour in directives of syscall (expected versions, files, exports or redirect)",
+		"bad.yaml:17: invalid version constraint \"<0.15\"",
+		"bad.yaml:18: exports of golang.org/x/sys/unix must be a mapping",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors, got %v:\n%v", len(expected), len(errs), errs)
+	}
+	for idx, err := range errs {
+		if err.Error() != expected[idx] {
+			t.Errorf("expected %q, got %q", expected[idx], err.Error())
+		}
+	}
+}
+
+func TestInlinesFor(t *testing.T) {
+	defer func(inlines map[string][]*PackageInline) { Inlines = inlines }(Inlines)
+	Inlines = make(map[string][]*PackageInline)
+	spec, err := ParseConfig([]byte(testConfig), "test.yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addInlines(spec)
+
+	cases := []struct {
+		version  string
+		expected string
+	}{
+		{"v0.14.0", InlineConstSym},
+		{"v0.15.0", InlineStubSym},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		var got string
+		if directives := InlinesFor("golang.org/x/sys/unix", tc.version); directives != nil {
+			got = directives.Exports["MAP_ANON"].Type
+		}
+		if got != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.version, tc.expected, got)
+		}
+	}
+}
+
+// Specs of a folder are loaded together, defining the same directive differently is an error
+func TestLoadInlinesFolder(t *testing.T) {
+	defer func(inlines map[string][]*PackageInline, layers []string) {
+		Inlines, ConfigLayers = inlines, layers
+	}(Inlines, ConfigLayers)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml":     "syscall:\n  exports:\n    EBADFD:\n      type: STUB\n",
+		"b.yaml":     "syscall:\n  exports:\n    EBADFD:\n      type: STUB\n    ENOTSUP:\n      type: EXPORT\n      replace: EOPNOTSUPP\n",
+		"README.txt": "not a spec",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := LoadInlines(dir); err != nil {
+		t.Fatal(err)
+	}
+	if directives := InlinesFor("syscall", ""); directives.Exports["EBADFD"].Type != InlineStubSym || directives.Exports["ENOTSUP"].Replace != "EOPNOTSUPP" {
+		t.Errorf("unexpected directives: %+v", directives.Exports)
+	}
+
+	conflicting := "syscall:\n  exports:\n    EBADFD:\n      type: EXPORT\n      replace: EBADF\n"
+	if err := os.WriteFile(filepath.Join(dir, "c.yaml"), []byte(conflicting), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := LoadInlines(dir)
+	expected := filepath.Join(dir, "c.yaml") + ":3: export directive syscall.EBADFD conflicts with the definition at " +
+		filepath.Join(dir, "a.yaml") + ":3 (STUB, here EXPORT EBADF)"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected conflict %q, got %v", expected, err)
+	}
+}
@@ -4,81 +4,307 @@
 package base
 
 import (
-	_ "embed"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
-	"gopkg.in/yaml.v3"
+	"github.com/zosopentools/wharf/internal/util"
 )
 
-//go:embed inlines.yaml
-var _DEFAULT_INLINES_EMBED []byte
+// Directive entries loaded for each package, in the order they were loaded (see InlinesFor)
+var Inlines map[string][]*PackageInline
 
-var Inlines map[string]*PackageInline
+// Configs the directives were loaded from, in the order they were loaded
+var ConfigLayers []string
+
+const (
+	// Bundle of default directives, one file per upstream module
+	DEFAULT_CONFIG_PATH = util.INTERNAL_PATH_PREFIX + "inlines"
+
+	// Config loaded from the folder of the workspace file
+	WORKSPACE_CONFIG_NAME = "wharf.yaml"
+
+	// Search path of configs loaded before the workspace config (files or folders, separated like PATH)
+	CONFIG_PATH_ENV = "WHARF_CONFIG_PATH"
+)
 
 const (
 	// Explicit file handler types
 	InlineDiffSym = "DIFF"
 
 	// Explicit exported symbol handler types
-	InlineExportSym = "EXPORT"
-	InlineConstSym  = "CONST"
+	InlineExportSym  = "EXPORT"
+	InlineConstSym   = "CONST"
+	InlineConvertSym = "CONVERT"
+	InlineStubSym    = "STUB"
 )
 
 // Directive description for editting a specific file
 //
 // These directives are used either immediately or if automated porting fails
 // as a means for porting packages using cached (user generated) changes
+//
+// DIFF directives apply the unified diff at Path to the file (or create it), the diff can change
+// several files (eg. the output of git format-patch) in which case only the changes to the file are used
 type FileInline struct {
 	Type string
-	Path string
+	Path string `json:",omitempty"`
+
+	Pos Location
 }
 
 // Directive description for editting definitions that cannot be ported
 //
-// If a package uses the specified definition we replace it with the contents provided here
+// If a package uses the specified definition we replace it with the contents provided here.
+// CONVERT directives instead convert values of definitions whose type differs on the platform
+// (fields are named like Stat_t.Dev) to the type the code expects.
+// STUB directives replace the references with a stub declared in a file generated in the package,
+// using the signature the definition has on linux (methods are named like Termios.Foo)
 type ExportInline struct {
 	Type    string
-	Replace string
+	Replace string `json:",omitempty"`
+
+	Pos Location
+}
+
+// Directive description for using a fork of a module instead of the module itself
+//
+// Only applies to entries keyed by a module path, the fork (Path at Version) replaces the module
+// in the workspace file (go work edit -replace) the first time one of its packages needs porting.
+// The go.mod of the fork can declare either path.
+type RedirectInline struct {
+	Path    string
+	Version string
+
+	Pos Location
 }
 
 // Directives related to a given package
+//
+// Versions restricts the directives to some versions of the module of the package (eg. "<v0.15.0"),
+// a package can have several entries for different versions
 type PackageInline struct {
-	Files   map[string]FileInline
-	Exports map[string]ExportInline
+	Package  string
+	Versions string                  `json:",omitempty"`
+	Files    map[string]FileInline   `json:",omitempty"`
+	Exports  map[string]ExportInline `json:",omitempty"`
+	Redirect *RedirectInline         `json:",omitempty"`
+
+	Pos Location
 }
 
 // Load the defaults on package init
 func initInlines() {
-	if err := yaml.Unmarshal(_DEFAULT_INLINES_EMBED, &Inlines); err != nil {
-		panic("default explicits configuration file is formatted incorrectly")
+	Inlines = make(map[string][]*PackageInline)
+	if err := LoadInlines(DEFAULT_CONFIG_PATH); err != nil {
+		panic(fmt.Sprintf("default explicits configuration file is formatted incorrectly: %v", err))
+	}
+}
+
+// Load the config layers on top of the defaults: the configs found in WHARF_CONFIG_PATH,
+// the workspace config (if there is one), then the given files or folders
+//
+// Directives of later layers take precedence (per package and per symbol)
+func LoadConfig(files []string) error {
+	for _, layer := range append(ConfigSearchPath(), files...) {
+		if err := LoadInlines(layer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Configs loaded before the ones given explicitly: the entries of WHARF_CONFIG_PATH, then the workspace config
+func ConfigSearchPath() []string {
+	var layers []string
+	for _, entry := range filepath.SplitList(os.Getenv(CONFIG_PATH_ENV)) {
+		// Like PATH, missing entries of the search path are skipped
+		if _, err := os.Stat(entry); entry != "" && err == nil {
+			layers = append(layers, entry)
+		}
+	}
+	if wsConfig := WorkspaceConfig(); wsConfig != "" {
+		layers = append(layers, wsConfig)
 	}
+	return layers
 }
 
-// Parse a given spec from source
-func LoadInlines(file string) error {
-	spec := make(map[string]*PackageInline)
-	data, err := os.ReadFile(file)
+// Path of the config of the workspace, empty if there is no workspace or it has no config
+func WorkspaceConfig() string {
+	work := GOWORK()
+	if work == "" {
+		return ""
+	}
+	wsConfig := filepath.Join(filepath.Dir(work), WORKSPACE_CONFIG_NAME)
+	if _, err := os.Stat(wsConfig); err != nil {
+		return ""
+	}
+	return wsConfig
+}
+
+// Load a config layer, its directives take precedence over the ones already loaded
+//
+// The layer is either a spec or a folder of specs (every *.yaml file in it, which must not conflict with each other).
+// Relative paths of file directives are resolved against the folder of the spec.
+// The layer is validated first, nothing is loaded from it if it has errors (see ConfigErrors)
+func LoadInlines(path string) error {
+	spec, err := readLayer(path)
 	if err != nil {
 		return err
 	}
 
-	err = yaml.Unmarshal(data, &Inlines)
+	addInlines(spec)
+	ConfigLayers = append(ConfigLayers, path)
+	return nil
+}
+
+// Check a config layer (a spec or a folder of specs) without loading it
+func ValidateConfig(path string) error {
+	_, err := readLayer(path)
+	return err
+}
+
+func readLayer(path string) ([]*PackageInline, error) {
+	files, err := configFiles(path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var spec []*PackageInline
+	var errs ConfigErrors
+	for _, file := range files {
+		data, err := util.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fileSpec, err := ParseConfig(data, file, util.Dir(file))
+		if ferrs, ok := err.(ConfigErrors); ok {
+			errs = append(errs, ferrs...)
+		} else if err != nil {
+			return nil, err
+		}
+		spec = append(spec, fileSpec...)
 	}
 
-	for pkgname, pkgSpec := range spec {
-		if defPkgSpec := Inlines[pkgname]; defPkgSpec != nil {
-			for file, fileSpec := range pkgSpec.Files {
-				defPkgSpec.Files[file] = fileSpec
+	errs = append(errs, conflicts(spec)...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return spec, nil
+}
+
+// Specs of a config layer, in the order they are loaded
+func configFiles(path string) ([]string, error) {
+	info, err := util.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := util.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") {
+			files = append(files, util.ResolvePath(path, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Directives of a layer that are defined differently for the same package, symbol and versions
+func conflicts(spec []*PackageInline) (errs ConfigErrors) {
+	type definition struct {
+		value string
+		pos   Location
+	}
+	defined := make(map[string]definition)
+	check := func(pkgSpec *PackageInline, key string, value string, pos Location) {
+		id := pkgSpec.Package + " " + pkgSpec.Versions + " " + key
+		prev, ok := defined[id]
+		if !ok {
+			defined[id] = definition{value: value, pos: pos}
+			return
+		}
+		if prev.value != value {
+			errs = append(errs, ConfigError{
+				Pos: pos,
+				Msg: fmt.Sprintf("%v conflicts with the definition at %v (%v, here %v)", key, prev.pos, prev.value, value),
+			})
+		}
+	}
+
+	for _, pkgSpec := range spec {
+		names := make([]string, 0, len(pkgSpec.Files)+len(pkgSpec.Exports))
+		for name := range pkgSpec.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fileSpec := pkgSpec.Files[name]
+			check(pkgSpec, "file directive "+pkgSpec.Package+"/"+name, fileSpec.Type+" "+fileSpec.Path, fileSpec.Pos)
+		}
+
+		names = names[:0]
+		for name := range pkgSpec.Exports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			expSpec := pkgSpec.Exports[name]
+			check(pkgSpec, "export directive "+pkgSpec.Package+"."+name, strings.TrimSpace(expSpec.Type+" "+expSpec.Replace), expSpec.Pos)
+		}
+
+		if redirect := pkgSpec.Redirect; redirect != nil {
+			check(pkgSpec, "redirect of "+pkgSpec.Package, redirect.Path+"@"+redirect.Version, redirect.Pos)
+		}
+	}
+	return errs
+}
+
+// Add the entries of a layer to the ones loaded
+func addInlines(spec []*PackageInline) {
+	for _, pkgSpec := range spec {
+		Inlines[pkgSpec.Package] = append(Inlines[pkgSpec.Package], pkgSpec)
+	}
+}
+
+// Directives for a package whose module is at the given version (empty if it has none, eg. main modules)
+//
+// Entries are merged in the order they were loaded, entries with a version constraint only apply to the versions
+// matching it. Returns nil if no entry applies
+func InlinesFor(pkgname string, version string) *PackageInline {
+	var merged *PackageInline
+	for _, pkgSpec := range Inlines[pkgname] {
+		if pkgSpec.Versions != "" {
+			if ok, _ := util.MatchVersion(pkgSpec.Versions, version); !ok {
+				continue
 			}
-			for export, expSpec := range pkgSpec.Exports {
-				defPkgSpec.Exports[export] = expSpec
+		}
+
+		if merged == nil {
+			merged = &PackageInline{
+				Package: pkgname,
+				Files:   make(map[string]FileInline),
+				Exports: make(map[string]ExportInline),
 			}
-		} else {
-			Inlines[pkgname] = pkgSpec
+		}
+		for name, fileSpec := range pkgSpec.Files {
+			merged.Files[name] = fileSpec
+		}
+		for export, expSpec := range pkgSpec.Exports {
+			merged.Exports[export] = expSpec
+		}
+		if pkgSpec.Redirect != nil {
+			merged.Redirect = pkgSpec.Redirect
 		}
 	}
-
-	return nil
+	return merged
 }
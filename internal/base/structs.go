@@ -3,8 +3,6 @@
 
 package base
 
-import "go/ast"
-
 type Output struct {
 	Modules  []ModulePin
 	Packages []PackagePatch
@@ -13,14 +11,54 @@ type Output struct {
 
 	GoWorkBackup string `json:",omitempty"`
 	ImportDir    string `json:",omitempty"`
+
+	// Decisions that were limited by offline mode
+	Offline []string `json:",omitempty"`
+}
+
+// A porting plan, saved by 'wharf plan' and applied by 'wharf apply'
+type Plan struct {
+	Output
+
+	// Platform the packages were ported to
+	GOOS   string
+	GOARCH string
+
+	// Workspace the plan was computed against and a hash of its contents
+	Workspace     string
+	WorkspaceHash string
+
+	// Contents of generated files, keyed by package path and file name
+	Cache map[string][]byte `json:",omitempty"`
+
+	// Contents of the catalog patches applied to modules, keyed by name
+	Catalog map[string][]byte `json:",omitempty"`
 }
 
 type ModulePin struct {
-	Path     string
-	Version  string
-	Pinned   string
-	Imported bool   `json:",omitempty"`
-	Dir      string `json:",omitempty"`
+	Path      string
+	Version   string
+	Pinned    string
+	Imported  bool   `json:",omitempty"`
+	Dir       string `json:",omitempty"`
+	PatchFile string `json:",omitempty"`
+
+	// Fork the module was replaced with by a redirect directive (Pinned is the version of the fork)
+	Redirect string `json:",omitempty"`
+
+	// Catalog patch applied to the module before porting it (the module is imported with the patch applied)
+	Patch string `json:",omitempty"`
+
+	// Oldest newer version of the module that already builds on the platform (upgrading to it avoids the import)
+	Native string `json:",omitempty"`
+}
+
+// Path of the module the pinned version is fetched from
+func (pin ModulePin) Source() string {
+	if pin.Redirect != "" {
+		return pin.Redirect
+	}
+	return pin.Path
 }
 
 type PackagePatch struct {
@@ -32,16 +70,32 @@ type PackagePatch struct {
 	Files      []FilePatch `json:",omitempty"`
 	TypeErrors []string
 	Error      string `json:",omitempty"`
+
+	// Changes that build but may not behave as on other platforms (eg. stubs that panic)
+	Warnings []string `json:",omitempty"`
+
+	// Oldest newer version of the module of the package that already builds on the platform
+	Native string `json:",omitempty"`
 }
 
 type FilePatch struct {
 	Name     string
-	Cached   string    `json:"-"`
-	Syntax   *ast.File `json:"-"`
+	Cached   string `json:"-"`
 	Build    bool
 	BaseFile string       `json:",omitempty"`
 	Symbols  []SymbolRepl `json:",omitempty"`
 	Lines    []LineDiff   `json:",omitempty"`
+
+	// Diff the file was patched with (or created by) from a DIFF directive
+	Diff string `json:",omitempty"`
+
+	// File was written from scratch by Wharf (eg. the stubs of missing definitions)
+	Generated bool `json:",omitempty"`
+}
+
+// The file is generated in the cache (copied from BaseFile, created by a diff or generated) instead of being retagged
+func (file FilePatch) FromCache() bool {
+	return file.BaseFile != "" || file.Diff != "" || file.Generated
 }
 
 type SymbolRepl struct {
@@ -4,10 +4,25 @@
 package pkg2
 
 import (
+	"go/ast"
+	"go/token"
 	"go/types"
+	"reflect"
 	"regexp"
+	"strconv"
 )
 
+// Error codes set by the type checker (values are fixed, see golang.org/x/tools/internal/typesinternal)
+const (
+	_CODE_INCOMPATIBLE_ASSIGN      = 23
+	_CODE_MISMATCHED_TYPES         = 46
+	_CODE_UNDECLARED_IMPORTED_NAME = 73
+	_CODE_UNDECLARED_NAME          = 75
+	_CODE_MISSING_FIELD_OR_METHOD  = 76
+)
+
+// Messages are only matched if the type checker does not provide error codes
+//
 // Errors came in the following formats:
 // [symbol] not declared by package [pkg]
 // undeclared name: [symbol]
@@ -29,8 +44,9 @@ var (
 	_UNDECLARED_NAME_ERR_MATCHER = regexp.MustCompile(`undeclared name: (\w+)`)
 	// undeclared name: terminalWidth
 
-	_UNDEFINED_TYPE_MEMBER_ERR_MATCHER = regexp.MustCompile(`(\w+\.\w+(?:\.\w+)?) undefined \(type \*?(?:(\w+)\.)?(\w+) has no field or method (\w+)`)
+	_UNDEFINED_TYPE_MEMBER_ERR_MATCHER = regexp.MustCompile(`(\S+\.\w+) undefined \(type \*?(?:(\w+)\.)?(\w+) has no field or method (\w+)`)
 	// file.Close undefined (type File has no field or method
+	// os.Stdin.Stat().Close undefined (type fs.FileInfo has no field or method
 
 	_NOT_DECLARED_BY_PACKAGE_ERR_MATCHER = regexp.MustCompile(`(\w+) not declared by package (\w+)`)
 	// EBADF not declared by package syscall
@@ -58,8 +74,13 @@ type TCBadName struct {
 func (TCBadName) teid() {}
 
 type TCBadImportName struct {
-	Name    TCBadName
+	Name TCBadName
+
+	// Name the package is referred to by in the file (or the package name if not imported by the file)
 	PkgName string
+
+	// Import path of the package (empty if only the message was available)
+	Path string
 }
 
 func (TCBadImportName) teid() {}
@@ -68,6 +89,200 @@ type TCBadOther struct{}
 
 func (TCBadOther) teid() {}
 
+// Info the type checker needs to record to classify errors with ClassifyTypeError
+func NewTypeInfo() *types.Info {
+	return &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Implicits:  make(map[ast.Node]types.Object),
+	}
+}
+
+// Classify an error from type checking a package using its error code and the identifier it was reported on
+//
+// The info must be recorded while checking the files (see NewTypeInfo). Falls back to matching the
+// message if the error has no code or its identifier cannot be found. The fallback is supported on
+// its own: it is all that is left if go/types stops exposing codes (see typeErrorCode), and it is
+// tested against the messages of each release
+func ClassifyTypeError(err types.Error, pkg *types.Package, files []*ast.File, info *types.Info) TypeError {
+	code := typeErrorCode(err)
+	if code == 0 {
+		return NewTypeCheckError(err)
+	}
+
+	err2 := TypeError{Err: err, Reason: TCBadOther{}}
+	switch code {
+	case _CODE_UNDECLARED_NAME, _CODE_UNDECLARED_IMPORTED_NAME, _CODE_MISSING_FIELD_OR_METHOD:
+	case _CODE_INCOMPATIBLE_ASSIGN, _CODE_MISMATCHED_TYPES:
+		if mismatch, ok := classifyMismatch(code, err.Pos, pkg, files, info); ok {
+			err2.Reason = mismatch
+		}
+		return err2
+	default:
+		return err2
+	}
+
+	ident, sel := findIdent(files, err.Pos)
+	if ident == nil {
+		return NewTypeCheckError(err)
+	}
+
+	switch code {
+	case _CODE_UNDECLARED_NAME:
+		err2.Reason = TCBadName{Name: ident.Name}
+
+	case _CODE_UNDECLARED_IMPORTED_NAME:
+		if sel == nil {
+			return NewTypeCheckError(err)
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return NewTypeCheckError(err)
+		}
+		pkgName, ok := info.Uses[x].(*types.PkgName)
+		if !ok {
+			return NewTypeCheckError(err)
+		}
+		err2.Reason = TCBadImportName{
+			Name:    TCBadName{Name: ident.Name},
+			PkgName: x.Name,
+			Path:    pkgName.Imported().Path(),
+		}
+
+	case _CODE_MISSING_FIELD_OR_METHOD:
+		if sel == nil {
+			return NewTypeCheckError(err)
+		}
+		tv, ok := info.Types[sel.X]
+		if !ok || tv.Type == nil {
+			return NewTypeCheckError(err)
+		}
+
+		typ := tv.Type
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+
+		var obj *types.TypeName
+		switch t := typ.(type) {
+		case interface{ Obj() *types.TypeName }:
+			obj = t.Obj()
+		case *types.Basic:
+			name := t.Name()
+			err2.Reason = TCBadName{MemberOf: &name, Name: ident.Name}
+			return err2
+		default:
+			// Members of unnamed types can't come from another package
+			return err2
+		}
+
+		memberOf := obj.Name()
+		une := TCBadName{MemberOf: &memberOf, Name: ident.Name}
+		if obj.Pkg() != nil && pkg != nil && obj.Pkg().Path() != pkg.Path() {
+			err2.Reason = TCBadImportName{
+				Name:    une,
+				PkgName: importName(files, err.Pos, obj.Pkg()),
+				Path:    obj.Pkg().Path(),
+			}
+		} else {
+			err2.Reason = une
+		}
+	}
+
+	return err2
+}
+
+// Code the type checker attached to an error, 0 if there is none
+//
+// The code is not exported by go/types, so it is read from the unexported field holding it. If the
+// field is renamed or removed this returns 0 and ClassifyTypeError matches the message instead
+func typeErrorCode(err types.Error) int {
+	field := reflect.ValueOf(err).FieldByName("go116code")
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(field.Int())
+	default:
+		return 0
+	}
+}
+
+// Find the file holding a position
+func fileAt(files []*ast.File, pos token.Pos) *ast.File {
+	for _, file := range files {
+		if file.Pos() <= pos && pos <= file.End() {
+			return file
+		}
+	}
+	return nil
+}
+
+// Find the identifier at a position, and the selector expression it is selected by (if any)
+func findIdent(files []*ast.File, pos token.Pos) (ident *ast.Ident, sel *ast.SelectorExpr) {
+	file := fileAt(files, pos)
+	if file == nil {
+		return
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		if ident != nil || node == nil || pos < node.Pos() || pos >= node.End() {
+			return false
+		}
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			if n.Sel.Pos() == pos {
+				ident, sel = n.Sel, n
+				return false
+			}
+		case *ast.Ident:
+			if n.Pos() == pos {
+				ident = n
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+// Name a package is imported as by the file holding a position, or its package name if not imported by the file
+func importName(files []*ast.File, pos token.Pos, pkg *types.Package) string {
+	if file := fileAt(files, pos); file != nil {
+		if name, ok := LocalName(file, pkg); ok && name != "" {
+			return name
+		}
+	}
+	return pkg.Name()
+}
+
+// Name a file refers to an imported package by, empty for dot imports
+//
+// Returns false if the file does not import the package (or only for its side effects)
+func LocalName(file *ast.File, pkg *types.Package) (string, bool) {
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != pkg.Path() {
+			continue
+		}
+
+		if spec.Name == nil {
+			return pkg.Name(), true
+		}
+		switch spec.Name.Name {
+		case "_":
+			return "", false
+		case ".":
+			return "", true
+		default:
+			return spec.Name.Name, true
+		}
+	}
+	return "", false
+}
+
+// Classify a type check error by matching its message
+//
+// Only used if the type checker provides no error code, as messages change between Go releases
 func NewTypeCheckError(err types.Error) (err2 TypeError) {
 	err2.Err = err
 	if match := _UNDEFINED_PACKAGE_ERR_MATCHER_NEW.FindStringSubmatch(err.Msg); match != nil {
@@ -0,0 +1,265 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package pkg2
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+const testDepSrc = `package unix
+
+type Termios struct{ Iflag uint32 }
+
+func Open() *Termios { return nil }
+`
+
+const testAppSrc = `package app
+
+import (
+	u "example.com/unix"
+)
+
+type local struct{}
+
+func f() {
+	_ = missingName
+	_ = u.MissingFunc
+	var t u.Termios
+	_ = t.MissingField
+	u.Open().MissingMethod()
+	var l local
+	_ = l.MissingLocal
+	var n int
+	_ = n.MissingBasic
+	_ = 1 + "a"
+}
+`
+
+const testMismatchDepSrc = `package unix
+
+type Mode_t uint32
+
+type Stat_t struct {
+	Dev  uint32
+	Mode uint16
+}
+
+type Timespec struct{ Nsec int32 }
+
+func Getpagesize() int32 { return 4096 }
+`
+
+const testMismatchAppSrc = `package app
+
+import (
+	"example.com/unix"
+)
+
+func size() int {
+	return unix.Getpagesize()
+}
+
+func dev(st *unix.Stat_t) uint64 {
+	var d uint64 = st.Dev
+	d = st.Dev
+	if st.Mode == uint32(0) {
+	}
+	var m unix.Mode_t = st.Mode
+	_ = m
+	ts := unix.Timespec{Nsec: int64(1)}
+	ts.Nsec = int64(2)
+	use(st.Dev)
+	_ = []uint64{uint64(d), st.Dev}
+	_ = d + uint32(1)
+	return d
+}
+
+func use(uint64) {}
+`
+
+// Summary of the classification of an error, to compare against
+func describeReason(reason TypeErrId) string {
+	switch r := reason.(type) {
+	case TCBadImportName:
+		if r.Name.MemberOf != nil {
+			return fmt.Sprintf("import %v(%v).%v.%v", r.PkgName, r.Path, *r.Name.MemberOf, r.Name.Name)
+		}
+		return fmt.Sprintf("import %v(%v).%v", r.PkgName, r.Path, r.Name.Name)
+	case TCBadName:
+		if r.MemberOf != nil {
+			return fmt.Sprintf("name %v.%v", *r.MemberOf, r.Name)
+		}
+		return "name " + r.Name
+	case TCMismatch:
+		name := r.Name.Name
+		if r.Name.MemberOf != nil {
+			name = *r.Name.MemberOf + "." + name
+		}
+		return fmt.Sprintf("mismatch %v(%v).%v -> %v", r.PkgName, r.Path, name, r.Want)
+	case TCBadOther:
+		return "other"
+	}
+	return fmt.Sprintf("unknown %T", reason)
+}
+
+type mapImporter map[string]*types.Package
+
+func (imp mapImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := imp[path]; ok {
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("unknown package %v", path)
+}
+
+// Type check an app against a dependency, returning the errors found and what is needed to classify them
+func checkTestApp(t *testing.T, depSrc, appSrc string) ([]types.Error, *types.Package, []*ast.File, *types.Info) {
+	fset := token.NewFileSet()
+
+	depFile, err := parser.ParseFile(fset, "unix.go", depSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep, err := (&types.Config{}).Check("example.com/unix", fset, []*ast.File{depFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appFile, err := parser.ParseFile(fset, "app.go", appSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []types.Error
+	cfg := &types.Config{
+		Importer: mapImporter{"example.com/unix": dep},
+		Error: func(err error) {
+			errs = append(errs, err.(types.Error))
+		},
+	}
+	files := []*ast.File{appFile}
+	info := NewTypeInfo()
+	pkg, _ := cfg.Check("example.com/app", fset, files, info)
+
+	return errs, pkg, files, info
+}
+
+func TestClassifyTypeError(t *testing.T) {
+	errs, pkg, files, info := checkTestApp(t, testDepSrc, testAppSrc)
+
+	if typeErrorCode(errs[0]) == 0 {
+		t.Fatal("type checker does not provide error codes, go/types no longer has the go116code field")
+	}
+
+	expected := []string{
+		"name missingName",
+		"import u(example.com/unix).MissingFunc",
+		"import u(example.com/unix).Termios.MissingField",
+		"import u(example.com/unix).Termios.MissingMethod",
+		"name local.MissingLocal",
+		"name int.MissingBasic",
+		"other",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors, got %v: %v", len(expected), len(errs), errs)
+	}
+
+	for idx, err := range errs {
+		if got := describeReason(ClassifyTypeError(err, pkg, files, info).Reason); got != expected[idx] {
+			t.Errorf("%v: expected %v, got %v", err, expected[idx], got)
+		}
+
+		// Classification must not depend on the wording of the message
+		err.Msg = "reworded message"
+		if got := describeReason(ClassifyTypeError(err, pkg, files, info).Reason); got != expected[idx] {
+			t.Errorf("%v (reworded): expected %v, got %v", err, expected[idx], got)
+		}
+	}
+}
+
+func TestClassifyMismatch(t *testing.T) {
+	errs, pkg, files, info := checkTestApp(t, testMismatchDepSrc, testMismatchAppSrc)
+
+	if typeErrorCode(errs[0]) == 0 {
+		t.Fatal("type checker does not provide error codes, go/types no longer has the go116code field")
+	}
+
+	expected := []string{
+		"mismatch unix(example.com/unix).Getpagesize -> int",
+		"mismatch unix(example.com/unix).Stat_t.Dev -> uint64",
+		"mismatch unix(example.com/unix).Stat_t.Dev -> uint64",
+		"mismatch unix(example.com/unix).Stat_t.Mode -> uint32",
+		"mismatch unix(example.com/unix).Stat_t.Mode -> unix.Mode_t",
+		"mismatch unix(example.com/unix).Timespec.Nsec -> int32",
+		"mismatch unix(example.com/unix).Timespec.Nsec -> int32",
+		"mismatch unix(example.com/unix).Stat_t.Dev -> uint64",
+		"mismatch unix(example.com/unix).Stat_t.Dev -> uint64",
+		"other",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors, got %v: %v", len(expected), len(errs), errs)
+	}
+
+	for idx, err := range errs {
+		if got := describeReason(ClassifyTypeError(err, pkg, files, info).Reason); got != expected[idx] {
+			t.Errorf("%v: expected %v, got %v", err, expected[idx], got)
+		}
+	}
+}
+
+// Messages of each Go release, used when the type checker provides no error codes
+func TestTypeErrorMessages(t *testing.T) {
+	cases := []struct {
+		release  string
+		msg      string
+		expected string
+	}{
+		{"go1.18", "undeclared name: missingName", "name missingName"},
+		{"go1.20", "undefined: missingName", "name missingName"},
+
+		{"go1.18", "MissingFunc not declared by package unix", "import unix().MissingFunc"},
+		{"go1.20", "undefined: unix.MissingFunc", "import unix().MissingFunc"},
+
+		{"go1.18", "t.MissingField undefined (type unix.Termios has no field or method MissingField)", "import unix().Termios.MissingField"},
+		{"go1.18", "p.MissingMethod undefined (type *unix.Termios has no field or method MissingMethod)", "import unix().Termios.MissingMethod"},
+		{"go1.20", "l.MissingLocal undefined (type local has no field or method MissingLocal)", "name local.MissingLocal"},
+		{"go1.20", "l.Missing undefined (type local has no field or method Missing, but does have missing)", "name local.Missing"},
+		{"go1.24", "l.Missing undefined (type local has no field or method Missing, but does have method missing)", "name local.Missing"},
+
+		{"go1.18", "cannot convert \"a\" (untyped string constant) to int", "other"},
+		{"go1.20", "invalid operation: 1 + \"a\" (mismatched types untyped int and untyped string)", "other"},
+	}
+
+	for _, tc := range cases {
+		err := types.Error{Msg: tc.msg}
+		if got := describeReason(ClassifyTypeError(err, nil, nil, nil).Reason); got != tc.expected {
+			t.Errorf("%v: %q: expected %v, got %v", tc.release, tc.msg, tc.expected, got)
+		}
+	}
+
+	// Messages of the current release, without their codes
+	errs, _, _, _ := checkTestApp(t, testDepSrc, testAppSrc)
+	expected := []string{
+		"name missingName",
+		"import u().MissingFunc",
+		"import unix().Termios.MissingField",
+		"import unix().Termios.MissingMethod",
+		"name local.MissingLocal",
+		"name int.MissingBasic",
+		"other",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors, got %v: %v", len(expected), len(errs), errs)
+	}
+	for idx, err := range errs {
+		err = types.Error{Fset: err.Fset, Pos: err.Pos, Msg: err.Msg, Soft: err.Soft}
+		if got := describeReason(ClassifyTypeError(err, nil, nil, nil).Reason); got != expected[idx] {
+			t.Errorf("%q: expected %v, got %v", err.Msg, expected[idx], got)
+		}
+	}
+}
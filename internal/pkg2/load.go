@@ -410,13 +410,18 @@ func loadPkg(pkg *Package) error {
 	return nil
 }
 
+// Load the syntax, constraints and imports of a file that go list doesn't know about (eg. a file patched by Wharf)
+func LoadGoFile(file *GoFile) error {
+	return loadGoFile(file, FileSet, true, true)
+}
+
 func loadGoFile(file *GoFile, fset *token.FileSet, syntax bool, forceLoad bool) error {
 	src, err := os.ReadFile(file.Path)
 	if err != nil {
 		return err
 	}
 
-	file.Tags = tags.Parse(file.Name, src, base.GOOS(), base.BuildTags)
+	file.Tags = tags.Parse(file.Name, src, base.GOOS(), base.GOARCH(), base.BuildTags)
 	if _, ok := file.Tags.(tags.Ignored); ok && !forceLoad {
 		return nil
 	}
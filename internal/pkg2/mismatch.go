@@ -0,0 +1,324 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package pkg2
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A value does not have the type the code expects, because a definition of an imported package
+// has a different type on the platform (eg. a syscall.Stat_t field that is uint32 instead of uint64)
+type TCMismatch struct {
+	// Definition of the imported package the value comes from (or is given to)
+	Name    TCBadName
+	PkgName string
+	Path    string
+
+	// Expression with the wrong type
+	Expr ast.Expr
+
+	// Type the expression has to be converted to, as written in the file
+	//
+	// Empty if a conversion cannot fix the error
+	Want string
+}
+
+func (TCMismatch) teid() {}
+
+// Definition of an imported package a mismatched value is related to
+type importedRef struct {
+	obj      types.Object
+	memberOf *types.TypeName
+}
+
+// Relate a mismatched types error to the imported definition that causes it
+//
+// Returns false if no definition of an imported package is involved
+func classifyMismatch(code int, pos token.Pos, pkg *types.Package, files []*ast.File, info *types.Info) (mis TCMismatch, ok bool) {
+	file := fileAt(files, pos)
+	if file == nil || pkg == nil {
+		return
+	}
+	path, _ := astutil.PathEnclosingInterval(file, pos, pos)
+
+	var want types.Type
+	var ref *importedRef
+
+	switch code {
+	case _CODE_MISMATCHED_TYPES:
+		// Errors are reported on one of the operands of the binary expression (depending on the operator),
+		// the operand using the imported definition is converted to the type of the other one
+		for _, node := range path {
+			bin, isBin := node.(*ast.BinaryExpr)
+			if !isBin {
+				continue
+			}
+			x, y := exprType(bin.X, info), exprType(bin.Y, info)
+			if x == nil || y == nil || types.Identical(x, y) {
+				continue
+			}
+
+			if ref = findImportedRef(bin.X, pkg, info); ref != nil {
+				mis.Expr, want = bin.X, y
+			} else if ref = findImportedRef(bin.Y, pkg, info); ref != nil {
+				mis.Expr, want = bin.Y, x
+			}
+			break
+		}
+
+	case _CODE_INCOMPATIBLE_ASSIGN:
+		// Errors are reported at the start of the value being assigned
+		idx := -1
+		for i, node := range path {
+			if _, isExpr := node.(ast.Expr); !isExpr || node.Pos() != pos {
+				break
+			}
+			idx = i
+		}
+		if idx < 0 || idx+1 >= len(path) {
+			return
+		}
+
+		mis.Expr = path[idx].(ast.Expr)
+		var dest ast.Node
+		want, dest, ref = expectedType(mis.Expr, path[idx+1:], info)
+		if ref != nil && !isImported(ref.obj, pkg) {
+			ref = nil
+		}
+		if ref == nil {
+			ref = findImportedRef(mis.Expr, pkg, info)
+		}
+		if ref == nil && dest != nil {
+			ref = findImportedRef(dest, pkg, info)
+		}
+	}
+
+	if ref == nil {
+		return
+	}
+
+	mis.Name = TCBadName{Name: ref.obj.Name()}
+	if ref.memberOf != nil {
+		memberOf := ref.memberOf.Name()
+		mis.Name.MemberOf = &memberOf
+	}
+	mis.PkgName = importName(files, pos, ref.obj.Pkg())
+	mis.Path = ref.obj.Pkg().Path()
+	mis.Want = conversionType(mis.Expr, want, pkg, file, info)
+
+	return mis, true
+}
+
+// Type the context of an expression expects it to have, and the expression it is given to (if any)
+//
+// The imported definition is also returned if the context refers to it without an expression (eg. the key of a struct literal)
+func expectedType(expr ast.Expr, path []ast.Node, info *types.Info) (types.Type, ast.Node, *importedRef) {
+	switch parent := path[0].(type) {
+	case *ast.AssignStmt:
+		if len(parent.Lhs) != len(parent.Rhs) {
+			break
+		}
+		for idx, rhs := range parent.Rhs {
+			if rhs == expr {
+				return exprType(parent.Lhs[idx], info), parent.Lhs[idx], nil
+			}
+		}
+
+	case *ast.ValueSpec:
+		if parent.Type != nil {
+			return exprType(parent.Type, info), parent.Type, nil
+		}
+
+	case *ast.KeyValueExpr:
+		if parent.Value != expr || len(path) < 2 {
+			break
+		}
+		if key, ok := parent.Key.(*ast.Ident); ok {
+			if field, ok := info.Uses[key].(*types.Var); ok && field.IsField() {
+				ref := &importedRef{obj: field}
+				if lit, ok := path[1].(*ast.CompositeLit); ok {
+					ref.memberOf = namedType(exprType(lit, info))
+				}
+				return field.Type(), nil, ref
+			}
+		}
+		if lit, ok := path[1].(*ast.CompositeLit); ok {
+			return elemType(exprType(lit, info)), lit.Type, nil
+		}
+
+	case *ast.CompositeLit:
+		for idx, elt := range parent.Elts {
+			if elt != expr {
+				continue
+			}
+			typ := exprType(parent, info)
+			if typ == nil {
+				break
+			}
+			if st, ok := typ.Underlying().(*types.Struct); ok && idx < st.NumFields() {
+				return st.Field(idx).Type(), nil, &importedRef{obj: st.Field(idx), memberOf: namedType(typ)}
+			}
+			return elemType(typ), parent.Type, nil
+		}
+
+	case *ast.CallExpr:
+		typ := exprType(parent.Fun, info)
+		if typ == nil {
+			break
+		}
+		sig, ok := typ.Underlying().(*types.Signature)
+		if !ok {
+			break
+		}
+		for idx, arg := range parent.Args {
+			if arg != expr {
+				continue
+			}
+			params := sig.Params()
+			if sig.Variadic() && idx >= params.Len()-1 {
+				last := params.At(params.Len() - 1).Type()
+				if parent.Ellipsis.IsValid() {
+					return last, parent.Fun, nil
+				}
+				return elemType(last), parent.Fun, nil
+			} else if idx < params.Len() {
+				return params.At(idx).Type(), parent.Fun, nil
+			}
+		}
+
+	case *ast.ReturnStmt:
+		for idx, result := range parent.Results {
+			if result != expr {
+				continue
+			}
+			for _, node := range path[1:] {
+				var typ types.Type
+				switch fn := node.(type) {
+				case *ast.FuncLit:
+					typ = exprType(fn, info)
+				case *ast.FuncDecl:
+					if obj := info.Defs[fn.Name]; obj != nil {
+						typ = obj.Type()
+					}
+				default:
+					continue
+				}
+				if sig, ok := typ.(*types.Signature); ok && idx < sig.Results().Len() {
+					return sig.Results().At(idx).Type(), nil, nil
+				}
+				break
+			}
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// Find the outermost reference to a definition of another package in an expression
+func findImportedRef(node ast.Node, pkg *types.Package, info *types.Info) (ref *importedRef) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if ref != nil {
+			return false
+		}
+
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			if sel, ok := info.Selections[n]; ok {
+				if isImported(sel.Obj(), pkg) {
+					ref = &importedRef{obj: sel.Obj(), memberOf: namedType(sel.Recv())}
+				}
+			} else if obj := info.Uses[n.Sel]; isImported(obj, pkg) {
+				ref = &importedRef{obj: obj}
+			}
+		case *ast.Ident:
+			if obj := info.Uses[n]; isImported(obj, pkg) {
+				ref = &importedRef{obj: obj}
+			}
+		}
+		return ref == nil
+	})
+	return
+}
+
+// Object is defined by another package (and is not the name of an import)
+func isImported(obj types.Object, pkg *types.Package) bool {
+	if _, ok := obj.(*types.PkgName); ok || obj == nil || obj.Pkg() == nil {
+		return false
+	}
+	return obj.Pkg().Path() != pkg.Path()
+}
+
+// Type to write in a conversion of an expression to the wanted type, empty if it can't be converted
+func conversionType(expr ast.Expr, want types.Type, pkg *types.Package, file *ast.File, info *types.Info) string {
+	got := exprType(expr, info)
+	if got == nil || want == nil || !types.ConvertibleTo(got, want) {
+		return ""
+	}
+	if basic, ok := want.(*types.Basic); ok && basic.Info()&types.IsUntyped != 0 {
+		return ""
+	}
+
+	// Every package in the type has to be imported by the file
+	writable := true
+	str := types.TypeString(want, func(other *types.Package) string {
+		if other.Path() == pkg.Path() {
+			return ""
+		}
+		name, ok := LocalName(file, other)
+		if !ok {
+			writable = false
+		}
+		return name
+	})
+
+	if !writable {
+		return ""
+	}
+	return str
+}
+
+// Type of an expression (or of the variable an identifier names)
+func exprType(expr ast.Expr, info *types.Info) types.Type {
+	if tv, ok := info.Types[expr]; ok && tv.Type != nil {
+		return tv.Type
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		if obj := info.Uses[ident]; obj != nil {
+			return obj.Type()
+		}
+		if obj := info.Defs[ident]; obj != nil {
+			return obj.Type()
+		}
+	}
+	return nil
+}
+
+// Type of the elements of a slice, array, map or channel type
+func elemType(typ types.Type) types.Type {
+	if typ == nil {
+		return nil
+	}
+	if elem, ok := typ.Underlying().(interface{ Elem() types.Type }); ok {
+		return elem.Elem()
+	}
+	return nil
+}
+
+// Name of a (pointer to a) named type, nil for other types
+func namedType(typ types.Type) *types.TypeName {
+	if typ == nil {
+		return nil
+	}
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	if named, ok := typ.(*types.Named); ok {
+		return named.Obj()
+	}
+	return nil
+}
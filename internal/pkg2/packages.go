@@ -295,7 +295,9 @@ func (gf *GoFile) String() string {
 	return gf.Name
 }
 
+// Original of a file generated by Wharf
 type ReplacedFile struct {
+	// Nil for files created by a diff
 	File   *GoFile
 	Reason any
 }
@@ -0,0 +1,62 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/util"
+)
+
+// Replace a module with a version, using a copy of the version patched with its catalog patch if there is one
+//
+// Returns the name of the catalog patch applied, the version is used as is if the patch doesn't apply
+func replaceVersion(modPath string, version string) (string, error) {
+	if name, diff, err := base.CatalogPatch(modPath, version); err != nil {
+		util.LogAction(util.ACT_ERROR, "%v@%v: %v", modPath, version, err)
+	} else if diff != nil {
+		if err := replacePatched(modPath, version, diff); err != nil {
+			util.LogAction(util.ACT_ERROR, "%v@%v: catalog patch %v does not apply: %v", modPath, version, name, err)
+		} else {
+			util.LogAction(util.ACT_PIN, "%v@%v: patched with catalog patch %v", modPath, version, name)
+			return name, nil
+		}
+	}
+	return "", util.GoWorkEditReplaceVersion(modPath, version)
+}
+
+// Replace a module with a copy of a version patched with the named catalog patch (eg. when replaying a plan)
+func ReplaceWithCatalogPatch(modPath string, version string, name string) error {
+	diff, err := base.ReadCatalogPatch(name)
+	if err != nil {
+		return err
+	}
+	return replacePatched(modPath, version, diff)
+}
+
+// Copy a version of a module from the module cache to the Wharf cache, patch it and replace the module with the copy
+func replacePatched(modPath string, version string, diff []byte) error {
+	srcdir, err := util.GoModDownloadDir(modPath, version)
+	if err != nil {
+		return err
+	}
+
+	// go.work does not allow an @ in the path of a replacement folder
+	dir := filepath.Join(base.Cache, "catalog", filepath.FromSlash(modPath), version)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := util.CopyModule(dir, srcdir, modPath); err != nil {
+		return err
+	}
+
+	_, subdir := util.SplitModulePath(modPath)
+	if err := util.PatchModule(dir, subdir, diff); err != nil {
+		return err
+	}
+
+	return util.GoWorkEditReplaceDir(modPath, dir)
+}
@@ -5,6 +5,7 @@ package port2
 
 import (
 	"fmt"
+	"go/types"
 
 	"github.com/zosopentools/wharf/internal/base"
 	"github.com/zosopentools/wharf/internal/pkg2"
@@ -13,12 +14,24 @@ import (
 type Context struct {
 	handles map[*pkg2.Package]*Handle
 	pins    map[string]versionPin
+
+	// Linux versions of imported packages, that stubs are generated from
+	linux map[*pkg2.Package]*types.Package
 }
 
 type versionPin struct {
 	version  string
 	pinTo    string
 	imported bool
+
+	// Fork the module is replaced with, pinTo is a version of the fork
+	redirect string
+
+	// Catalog patch applied to the pinned version
+	patch string
+
+	// Versions left to try by the version search
+	candidates []string
 }
 
 func (pin versionPin) isPinned() bool {
@@ -29,6 +42,7 @@ func NewContext() *Context {
 	return &Context{
 		handles: make(map[*pkg2.Package]*Handle),
 		pins:    make(map[string]versionPin),
+		linux:   make(map[*pkg2.Package]*types.Package),
 	}
 }
 
@@ -42,6 +56,16 @@ func (ctx *Context) GetHandle(pkg *pkg2.Package) *Handle {
 	return ctx.handles[pkg]
 }
 
+// Get the record of decisions made while porting the package with the given import path
+func (ctx *Context) Trace(importPath string) (*Trace, bool) {
+	for pkg, handle := range ctx.handles {
+		if pkg.Meta.ImportPath == importPath {
+			return &handle.trace, true
+		}
+	}
+	return nil, false
+}
+
 func (ctx *Context) CollectPins() []base.ModulePin {
 	pins := make([]base.ModulePin, 0, len(ctx.pins))
 	for path, pin := range ctx.pins {
@@ -49,7 +73,9 @@ func (ctx *Context) CollectPins() []base.ModulePin {
 			Path:     path,
 			Version:  pin.version,
 			Pinned:   pin.pinTo,
-			Imported: pin.imported,
+			Imported: pin.imported || pin.patch != "",
+			Redirect: pin.redirect,
+			Patch:    pin.patch,
 		})
 	}
 	return pins
@@ -58,11 +84,23 @@ func (ctx *Context) CollectPins() []base.ModulePin {
 func (ctx *Context) CollectPatches() []base.PackagePatch {
 	patches := make([]base.PackagePatch, 0, 20)
 	for pkg, handle := range ctx.handles {
+		if handle.err != nil {
+			patches = append(patches, base.PackagePatch{
+				Path:       pkg.Meta.ImportPath,
+				Dir:        pkg.Meta.Dir,
+				Module:     moduleOf(pkg),
+				TypeErrors: typeErrorStrings(handle.portErrs),
+				Error:      handle.err.Error(),
+			})
+			continue
+		}
+
 		if !handle.patched {
 			continue
 		}
 
 		files := make([]base.FilePatch, 0, len(pkg.Builds[handle.buildIdx].Files))
+		var warnings []string
 
 		// Mark the files that were active in the default config
 		defaultFiles := make(map[*pkg2.GoFile]bool)
@@ -80,27 +118,31 @@ func (ctx *Context) CollectPatches() []base.PackagePatch {
 			fileAction.Name = gofile.Name
 			fileAction.Build = true
 			fileAction.Cached = gofile.Path
-			fileAction.Syntax = gofile.Syntax
 
 			if gofile.Replaced != nil {
-				repl := gofile.Replaced.File
-				fileAction.BaseFile = repl.Name
-
-				for iname, symbols := range gofile.Replaced.Reason.(map[string]map[string]base.ExportInline) {
-					for symname, ed := range symbols {
-						var repstr string
-						switch ed.Type {
-						case base.InlineExportSym:
-							repstr = iname + "." + ed.Replace
-						case base.InlineConstSym:
-							repstr = ed.Replace
-						default:
-							handle.panic("unknown export directive type")
+				if repl := gofile.Replaced.File; repl != nil {
+					fileAction.BaseFile = repl.Name
+				}
+
+				switch reason := gofile.Replaced.Reason.(type) {
+				case fileEdits:
+					for iname, symbols := range reason.Exports {
+						for symname, ed := range symbols {
+							original, repstr := exportReplacement(iname, symname, ed)
+							fileAction.Symbols = append(fileAction.Symbols, base.SymbolRepl{
+								Original: original,
+								New:      repstr,
+							})
 						}
-						fileAction.Symbols = append(fileAction.Symbols, base.SymbolRepl{
-							Original: fmt.Sprintf("%v.%v", iname, symname),
-							New:      repstr,
-						})
+					}
+					fileAction.Symbols = append(fileAction.Symbols, reason.Conversions...)
+				case fileDiff:
+					fileAction.Diff = reason.Path
+				case fileStubs:
+					fileAction.Generated = true
+					fileAction.Symbols = append(fileAction.Symbols, reason.Symbols...)
+					for _, symbol := range reason.Panics {
+						warnings = append(warnings, fmt.Sprintf("the stub of %v panics when called, it has no error to return", symbol))
 					}
 				}
 			}
@@ -117,13 +159,52 @@ func (ctx *Context) CollectPatches() []base.PackagePatch {
 		}
 
 		patches = append(patches, base.PackagePatch{
-			Path:   pkg.Meta.ImportPath,
-			Module: pkg.Meta.Module.Path,
-			Tags:   pkg.Builds[handle.buildIdx].Platforms,
-			Files:  files,
+			Path:       pkg.Meta.ImportPath,
+			Dir:        pkg.Meta.Dir,
+			Module:     moduleOf(pkg),
+			Tags:       pkg.Builds[handle.buildIdx].Platforms,
+			Files:      files,
+			TypeErrors: typeErrorStrings(handle.portErrs),
+			Warnings:   warnings,
 		})
 
 	}
 
 	return patches
 }
+
+func moduleOf(pkg *pkg2.Package) string {
+	if pkg.Meta.Module == nil {
+		return ""
+	}
+	return pkg.Meta.Module.Path
+}
+
+// Version of the module of a package as it is built (empty for the standard library and folders the workspace replaces modules with)
+func (ctx *Context) moduleVersion(pkg *pkg2.Package) string {
+	module := pkg.Meta.Module
+	if module == nil {
+		return ""
+	}
+	// Pinned modules may be replaced by a folder (eg. a copy patched with a catalog patch)
+	if pin := ctx.pins[module.Path]; pin.isPinned() {
+		return pin.pinTo
+	}
+	if module.Replace != nil {
+		return module.Replace.Version
+	}
+	return module.Version
+}
+
+// Inline directives that apply to the version of a package
+func (ctx *Context) directivesFor(pkg *pkg2.Package) *base.PackageInline {
+	return base.InlinesFor(pkg.Meta.ImportPath, ctx.moduleVersion(pkg))
+}
+
+func typeErrorStrings(errs []pkg2.TypeError) []string {
+	strs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		strs = append(strs, err.Error())
+	}
+	return strs
+}
@@ -0,0 +1,37 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"testing"
+
+	"github.com/zosopentools/wharf/internal/pkg2"
+)
+
+func TestModuleVersion(t *testing.T) {
+	folder := &pkg2.Module{Path: "/cache/catalog/example.com/m/v1.1.0"}
+	cases := []struct {
+		name     string
+		module   *pkg2.Module
+		pin      versionPin
+		expected string
+	}{
+		{"std", nil, versionPin{}, ""},
+		{"required", &pkg2.Module{Path: "example.com/m", Version: "v1.0.0"}, versionPin{}, "v1.0.0"},
+		{"replaced", &pkg2.Module{Path: "example.com/m", Version: "v1.0.0", Replace: &pkg2.Module{Path: "example.com/m", Version: "v1.1.0"}}, versionPin{}, "v1.1.0"},
+		{"folder", &pkg2.Module{Path: "example.com/m", Version: "v1.0.0", Replace: folder}, versionPin{}, ""},
+		// The patched copy of a pinned version is a folder, the version comes from the pin
+		{"pinned folder", &pkg2.Module{Path: "example.com/m", Version: "v1.0.0", Replace: folder}, versionPin{version: "v1.0.0", pinTo: "v1.1.0", patch: "m@v1.1.0.patch"}, "v1.1.0"},
+	}
+	for _, tc := range cases {
+		ctx := NewContext()
+		if tc.module != nil {
+			ctx.pins[tc.module.Path] = tc.pin
+		}
+		pkg := &pkg2.Package{Meta: &pkg2.MetaPackage{ImportPath: "example.com/m", Module: tc.module}}
+		if version := ctx.moduleVersion(pkg); version != tc.expected {
+			t.Errorf("%v: expected version %q, got %q", tc.name, tc.expected, version)
+		}
+	}
+}
@@ -12,9 +12,36 @@ type PatchError struct {
 
 	Suggestion string
 
-	// TODO: Add patch trace
+	// Record of everything that was tried while porting the package
+	Trace *Trace
 }
 
 func (e PatchError) Error() string {
 	return fmt.Sprintf("cannot patch %q because %v", e.PkgPath, e.Reason)
 }
+
+// Record of the decisions made while porting a package
+type Trace struct {
+	// Module versions the package was checked at
+	Versions []string `json:",omitempty"`
+
+	// Build configs that were tried, in order
+	Attempts []Attempt `json:",omitempty"`
+
+	// Inline directives that were considered
+	Inlines []string `json:",omitempty"`
+
+	// Final outcome of porting the package
+	Result string `json:",omitempty"`
+}
+
+// A build config that was tried while porting a package
+type Attempt struct {
+	Config string
+
+	// Type errors the config produced
+	Errors []string `json:",omitempty"`
+
+	// Why the config was rejected, empty if it was selected
+	Rejected string `json:",omitempty"`
+}
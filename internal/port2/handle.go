@@ -6,8 +6,10 @@ package port2
 import (
 	"fmt"
 	"go/types"
+	"strings"
 
 	"github.com/zosopentools/wharf/internal/pkg2"
+	"github.com/zosopentools/wharf/internal/util"
 )
 
 type Stage uint8
@@ -19,6 +21,14 @@ type Handle struct {
 	types *types.Package
 	errs  []pkg2.TypeError
 
+	// Type errors seen right before the package was last ported
+	portErrs []pkg2.TypeError
+	// Error that stopped the package from being ported
+	err error
+
+	// Record of the decisions made while porting the package
+	trace Trace
+
 	buildIdx int
 
 	// Package has valid and complete type data for the current selected build
@@ -74,9 +84,17 @@ func (handle *Handle) Refresh() {
 	}
 }
 
-func (handle *Handle) typeCheck(build int, cfg *types.Config) (typed *types.Package, errs []pkg2.TypeError) {
+func (handle *Handle) typeCheck(build int, cfg *types.Config) (*types.Package, []pkg2.TypeError) {
+	typed, errs, _ := handle.typeCheckInfo(build, cfg)
+	return typed, errs
+}
+
+// Type check a config, also returning what the type checker resolved each identifier to
+func (handle *Handle) typeCheckInfo(build int, cfg *types.Config) (typed *types.Package, errs []pkg2.TypeError, info *types.Info) {
+	// Errors are classified once checking is done, when the info on every identifier is recorded
+	var terrs []types.Error
 	cfg.Error = func(err error) {
-		errs = append(errs, pkg2.NewTypeCheckError(err.(types.Error)))
+		terrs = append(terrs, err.(types.Error))
 	}
 
 	cfg.Importer = (importer)(func(path string) (*types.Package, error) {
@@ -101,10 +119,61 @@ func (handle *Handle) typeCheck(build int, cfg *types.Config) (typed *types.Pack
 		return ih.types, nil
 	})
 
-	typed, _ = cfg.Check(handle.pkg.Meta.ImportPath, pkg2.FileSet, handle.pkg.Builds[build].Syntax, nil)
+	syntax := handle.pkg.Builds[build].Syntax
+	info = pkg2.NewTypeInfo()
+	typed, _ = cfg.Check(handle.pkg.Meta.ImportPath, pkg2.FileSet, syntax, info)
+	for _, err := range terrs {
+		errs = append(errs, pkg2.ClassifyTypeError(err, typed, syntax, info))
+	}
+	util.LogAction(util.ACT_TYPECHECK, "%v: config %v: %v error(s)", handle.pkg.Meta.ImportPath, handle.configName(build), len(errs))
 	return
 }
 
+// Describe a build config for logs and messages
+func (handle *Handle) configName(build int) string {
+	if build == 0 {
+		return "#0 (default)"
+	}
+	return fmt.Sprintf("#%v (%v)", build, strings.Join(handle.pkg.Builds[build].Platforms, ", "))
+}
+
 func (handle *Handle) panic(msg string) {
 	panic(fmt.Sprintf("%v: %v", handle.pkg.Meta.ImportPath, msg))
 }
+
+// Record the outcome of trying a build config, in the trace and the action log
+//
+// An empty rejection reason marks the config as selected
+func (handle *Handle) tried(build int, errs []pkg2.TypeError, rejected string) {
+	handle.trace.Attempts = append(handle.trace.Attempts, Attempt{
+		Config:   handle.configName(build),
+		Errors:   typeErrorStrings(errs),
+		Rejected: rejected,
+	})
+
+	if rejected == "" {
+		util.LogAction(util.ACT_CONFIG, "%v: selected config %v", handle.pkg.Meta.ImportPath, handle.configName(build))
+	} else {
+		util.LogAction(util.ACT_CONFIG, "%v: config %v rejected: %v", handle.pkg.Meta.ImportPath, handle.configName(build), rejected)
+	}
+}
+
+// Record an inline directive that was considered for the package
+func (handle *Handle) considered(inline string) {
+	for _, seen := range handle.trace.Inlines {
+		if seen == inline {
+			return
+		}
+	}
+	handle.trace.Inlines = append(handle.trace.Inlines, inline)
+}
+
+// Create the error reported when the package cannot be ported
+func (handle *Handle) fail(reason string, suggestion string) error {
+	return PatchError{
+		PkgPath:    handle.pkg.Meta.ImportPath,
+		Reason:     reason,
+		Suggestion: suggestion,
+		Trace:      &handle.trace,
+	}
+}
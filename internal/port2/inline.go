@@ -0,0 +1,267 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/pkg2"
+)
+
+// Import name used for the symbols of dot imported packages
+const DOT_IMPORT_NAME = "."
+
+// A change to the source of a file, the bytes between the offsets are replaced with the text
+//
+// Insertions have the same start and end offset
+type splice struct {
+	start int
+	end   int
+	text  string
+}
+
+// Make changes to the source of a file, the changes may touch but not overlap
+func applySplices(src []byte, splices []splice) []byte {
+	// Text inserted at the same offset ends up in front of text inserted before it, so at the
+	// same offset replacements go first, then openings and closing parentheses last
+	rank := func(sp splice) int {
+		switch {
+		case sp.end > sp.start:
+			return 0
+		case sp.text != ")":
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	// Splice from the end of the file so the offsets of the remaining changes stay valid
+	sort.SliceStable(splices, func(i, j int) bool {
+		if splices[i].start != splices[j].start {
+			return splices[i].start > splices[j].start
+		}
+		return rank(splices[i]) < rank(splices[j])
+	})
+
+	out := append([]byte(nil), src...)
+	for _, sp := range splices {
+		out = append(out[:sp.start], append([]byte(sp.text), out[sp.end:]...)...)
+	}
+	return out
+}
+
+// Changes that wrap the mismatched values of a file in conversions to the type the code expects
+//
+// Also returns the replacements made, to report
+func conversionSplices(src []byte, conversions []pkg2.TCMismatch) ([]splice, []base.SymbolRepl) {
+	var splices []splice
+	var repls []base.SymbolRepl
+	seen := make(map[token.Pos]bool)
+	for _, conv := range conversions {
+		if seen[conv.Expr.Pos()] {
+			continue
+		}
+		seen[conv.Expr.Pos()] = true
+
+		start := pkg2.FileSet.Position(conv.Expr.Pos()).Offset
+		end := pkg2.FileSet.Position(conv.Expr.End()).Offset
+		splices = append(splices, splice{start, start, conv.Want + "("}, splice{end, end, ")"})
+
+		original := string(src[start:end])
+		repls = append(repls, base.SymbolRepl{
+			Original: original,
+			New:      conv.Want + "(" + original + ")",
+		})
+	}
+	return splices, repls
+}
+
+// Changes that replace the references of a file to symbols with export directives
+//
+// Only references the type checker resolved to the imported package are replaced: a selector on
+// the name the file imports the package as, or an undeclared identifier for dot imported packages
+func exportSplices(file *ast.File, info *types.Info, iEdits map[string]map[string]base.ExportInline) []splice {
+	if len(iEdits) == 0 {
+		return nil
+	}
+
+	var splices []splice
+	replace := func(node ast.Node, text string) {
+		splices = append(splices, splice{
+			start: pkg2.FileSet.Position(node.Pos()).Offset,
+			end:   pkg2.FileSet.Position(node.End()).Offset,
+			text:  text,
+		})
+	}
+
+	// References to imports that are replaced entirely, an import left without references has to be blanked
+	replaced := make(map[types.Object]int)
+
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			x, ok := n.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if _, ok := info.Uses[x].(*types.PkgName); !ok {
+				// Field or method selection, the selected name can't be a symbol of a package
+				ast.Inspect(n.X, visit)
+				return false
+			}
+
+			if ed, ok := iEdits[x.Name][n.Sel.Name]; ok {
+				switch ed.Type {
+				case base.InlineExportSym:
+					replace(n.Sel, ed.Replace)
+				case base.InlineConstSym:
+					replace(n, constText(ed.Replace))
+					replaced[info.Uses[x]]++
+				case base.InlineStubSym:
+					replace(n, ed.Replace)
+					replaced[info.Uses[x]]++
+				}
+			}
+			return false
+
+		case *ast.CallExpr:
+			// Calls to missing methods are replaced with calls to their stub, given the value the method is called on
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || info.Selections[sel] != nil {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); ok && info.Uses[x] != nil {
+				if _, ok := info.Uses[x].(*types.PkgName); ok {
+					return true
+				}
+			}
+			named := namedOf(info.TypeOf(sel.X))
+			if named == nil || named.Obj().Pkg() == nil {
+				return true
+			}
+			iname, imported := pkg2.LocalName(file, named.Obj().Pkg())
+			if imported && iname == "" {
+				iname = DOT_IMPORT_NAME
+			}
+			ed, ok := iEdits[iname][named.Obj().Name()+"."+sel.Sel.Name]
+			if !ok || ed.Type != base.InlineStubSym {
+				return true
+			}
+
+			sep := ""
+			if len(n.Args) > 0 {
+				sep = ", "
+			}
+			xstart := pkg2.FileSet.Position(sel.X.Pos()).Offset
+			splices = append(splices,
+				splice{start: xstart, end: xstart, text: ed.Replace + "("},
+				splice{
+					start: pkg2.FileSet.Position(sel.X.End()).Offset,
+					end:   pkg2.FileSet.Position(n.Lparen).Offset + 1,
+					text:  sep,
+				},
+			)
+			ast.Inspect(sel.X, visit)
+			for _, arg := range n.Args {
+				ast.Inspect(arg, visit)
+			}
+			return false
+
+		case *ast.Ident:
+			if info.Uses[n] != nil || info.Defs[n] != nil {
+				return false
+			}
+			if ed, ok := iEdits[DOT_IMPORT_NAME][n.Name]; ok {
+				switch ed.Type {
+				case base.InlineExportSym, base.InlineStubSym:
+					replace(n, ed.Replace)
+				case base.InlineConstSym:
+					replace(n, constText(ed.Replace))
+				}
+			}
+			return false
+		}
+		return true
+	}
+
+	ast.Inspect(file, visit)
+
+	if len(replaced) == 0 {
+		return splices
+	}
+	uses := make(map[types.Object]int)
+	for _, obj := range info.Uses {
+		if replaced[obj] > 0 {
+			uses[obj]++
+		}
+	}
+	for _, spec := range file.Imports {
+		obj := info.Implicits[spec]
+		if spec.Name != nil {
+			obj = info.Defs[spec.Name]
+		}
+		if obj == nil || replaced[obj] == 0 || uses[obj] > replaced[obj] {
+			continue
+		}
+
+		// Keep the import (so the package is still imported by the same files), but without a name
+		if spec.Name != nil {
+			replace(spec.Name, "_")
+		} else {
+			start := pkg2.FileSet.Position(spec.Path.Pos()).Offset
+			splices = append(splices, splice{start: start, end: start, text: "_ "})
+		}
+	}
+	return splices
+}
+
+// Text of a reference to a symbol and its replacement, as reported to the user
+func exportReplacement(iname string, sname string, ed base.ExportInline) (string, string) {
+	original := iname + "." + sname
+	if iname == DOT_IMPORT_NAME {
+		original = sname
+	}
+
+	switch ed.Type {
+	case base.InlineExportSym:
+		if iname == DOT_IMPORT_NAME {
+			return original, ed.Replace
+		}
+		return original, iname + "." + ed.Replace
+	case base.InlineConstSym, base.InlineStubSym:
+		return original, ed.Replace
+	default:
+		panic("unknown export directive type")
+	}
+}
+
+// Value of a CONST directive as written in place of a reference, in parentheses unless it is a single operand
+func constText(value string) string {
+	expr, err := parser.ParseExpr(value)
+	if err != nil {
+		return value
+	}
+
+	switch expr.(type) {
+	case *ast.BasicLit, *ast.Ident, *ast.SelectorExpr, *ast.CallExpr, *ast.ParenExpr, *ast.IndexExpr, *ast.CompositeLit:
+		return value
+	default:
+		return "(" + value + ")"
+	}
+}
+
+// Named type of a value, or of the value a pointer points to
+func namedOf(typ types.Type) *types.Named {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, _ := typ.(*types.Named)
+	return named
+}
@@ -0,0 +1,232 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"testing"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/pkg2"
+)
+
+const testUnixSrc = `package unix
+
+const EBADF = 9
+
+const EBADFDX = 10
+
+type Termios struct{ Iflag uint32 }
+`
+
+type mapImporter map[string]*types.Package
+
+func (imp mapImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := imp[path]; ok {
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("unknown package %v", path)
+}
+
+// Replace the symbols of a file with export directives, as done when applying them to a config
+func replaceExports(t *testing.T, src string, iEdits map[string]map[string]base.ExportInline) string {
+	depFile, err := parser.ParseFile(pkg2.FileSet, "unix.go", testUnixSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep, err := (&types.Config{}).Check("example.com/unix", pkg2.FileSet, []*ast.File{depFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parser.ParseFile(pkg2.FileSet, "app.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &types.Config{
+		Importer: mapImporter{"example.com/unix": dep},
+		Error:    func(error) {},
+	}
+	info := pkg2.NewTypeInfo()
+	cfg.Check("example.com/app", pkg2.FileSet, []*ast.File{file}, info)
+
+	return string(applySplices([]byte(src), exportSplices(file, info, iEdits)))
+}
+
+func TestExportSplices(t *testing.T) {
+	src := `package app
+
+import (
+	sys "example.com/unix"
+)
+
+// sys.EBADFD is not defined on every platform
+func code() (int, string) {
+	sys := struct{ EBADFD int }{}
+	_ = sys.EBADFD
+	return sysCode() + sys.EBADFD, "sys.EBADFD"
+}
+
+func sysCode() int {
+	return sys.EBADFD + sys.EBADFDX
+}
+`
+	expected := `package app
+
+import (
+	sys "example.com/unix"
+)
+
+// sys.EBADFD is not defined on every platform
+func code() (int, string) {
+	sys := struct{ EBADFD int }{}
+	_ = sys.EBADFD
+	return sysCode() + sys.EBADFD, "sys.EBADFD"
+}
+
+func sysCode() int {
+	return sys.EBADF + sys.EBADFDX
+}
+`
+
+	got := replaceExports(t, src, map[string]map[string]base.ExportInline{
+		"sys": {"EBADFD": {Type: base.InlineExportSym, Replace: "EBADF"}},
+	})
+	if got != expected {
+		t.Errorf("unexpected replacement:\n%v", got)
+	}
+}
+
+func TestExportSplicesDotImport(t *testing.T) {
+	src := `package app
+
+import (
+	. "example.com/unix"
+)
+
+func code() int {
+	EBADFDX := EBADFD
+	return EBADFDX + MAP_ANON*2
+}
+`
+	expected := `package app
+
+import (
+	. "example.com/unix"
+)
+
+func code() int {
+	EBADFDX := EBADF
+	return EBADFDX + (1 << 5)*2
+}
+`
+
+	got := replaceExports(t, src, map[string]map[string]base.ExportInline{
+		DOT_IMPORT_NAME: {
+			"EBADFD":   {Type: base.InlineExportSym, Replace: "EBADF"},
+			"MAP_ANON": {Type: base.InlineConstSym, Replace: "1 << 5"},
+		},
+	})
+	if got != expected {
+		t.Errorf("unexpected replacement:\n%v", got)
+	}
+}
+
+func TestExportSplicesStub(t *testing.T) {
+	src := `package app
+
+import (
+	"fmt"
+
+	"example.com/unix"
+)
+
+func code(t *unix.Termios) {
+	fd, err := unix.EpollCreate(1)
+	fmt.Println(fd, err, unix.EPOLLIN)
+	t.Flush(unix.EBADF)
+}
+`
+	expected := `package app
+
+import (
+	"fmt"
+
+	"example.com/unix"
+)
+
+func code(t *unix.Termios) {
+	fd, err := wharf_unix_EpollCreate(1)
+	fmt.Println(fd, err, wharf_unix_EPOLLIN)
+	wharf_unix_Termios_Flush(t, wharf_unix_EBADF)
+}
+`
+
+	got := replaceExports(t, src, map[string]map[string]base.ExportInline{
+		"unix": {
+			"EpollCreate":   {Type: base.InlineStubSym, Replace: "wharf_unix_EpollCreate"},
+			"EPOLLIN":       {Type: base.InlineStubSym, Replace: "wharf_unix_EPOLLIN"},
+			"EBADF":         {Type: base.InlineStubSym, Replace: "wharf_unix_EBADF"},
+			"Termios.Flush": {Type: base.InlineStubSym, Replace: "wharf_unix_Termios_Flush"},
+		},
+	})
+	if got != expected {
+		t.Errorf("unexpected replacement:\n%v", got)
+	}
+}
+
+// Imports left without references once their definitions are stubbed must not be reported as unused
+func TestExportSplicesStubImport(t *testing.T) {
+	src := `package app
+
+import (
+	"fmt"
+	sys "example.com/unix"
+	"example.com/unix"
+)
+
+func code() {
+	fmt.Println(sys.EPOLLIN, unix.EPOLLIN)
+}
+`
+	expected := `package app
+
+import (
+	"fmt"
+	_ "example.com/unix"
+	_ "example.com/unix"
+)
+
+func code() {
+	fmt.Println(wharf_unix_EPOLLIN, wharf_unix_EPOLLIN)
+}
+`
+
+	stub := base.ExportInline{Type: base.InlineStubSym, Replace: "wharf_unix_EPOLLIN"}
+	got := replaceExports(t, src, map[string]map[string]base.ExportInline{
+		"sys":  {"EPOLLIN": stub},
+		"unix": {"EPOLLIN": stub},
+	})
+	if got != expected {
+		t.Errorf("unexpected replacement:\n%v", got)
+	}
+}
+
+func TestApplySplices(t *testing.T) {
+	src := []byte("x := st.Dev + unix.MAP_ANON")
+	got := applySplices(src, []splice{
+		{start: 5, end: 5, text: "uint64("},
+		{start: 11, end: 11, text: ")"},
+		{start: 14, end: 27, text: "0x20"},
+		{start: 14, end: 14, text: "int("},
+		{start: 27, end: 27, text: ")"},
+	})
+	if expected := "x := uint64(st.Dev) + int(0x20)"; string(got) != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
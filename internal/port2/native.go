@@ -0,0 +1,145 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/tags"
+	"github.com/zosopentools/wharf/internal/util"
+	"golang.org/x/mod/semver"
+)
+
+// Look for newer versions of the imported modules that already build on the platform
+//
+// The oldest such version is recorded in the pin of the module and in the patches of its packages,
+// upgrading to it removes the need to import and edit the module
+func FindNativeSupport(out *base.Output) {
+	for idx := range out.Modules {
+		pin := &out.Modules[idx]
+
+		// Forks are picked because they support the platform
+		if !pin.Imported || pin.Redirect != "" {
+			continue
+		}
+
+		var dirs []string
+		for _, patch := range out.Packages {
+			if patch.Module == pin.Path {
+				dirs = append(dirs, strings.TrimPrefix(strings.TrimPrefix(patch.Path, pin.Path), "/"))
+			}
+		}
+		if len(dirs) == 0 {
+			continue
+		}
+
+		base.NoteOffline("%v: only versions available offline were checked for %v support", pin.Path, base.GOOS())
+		version, err := nativeVersion(pin.Path, pin.Pinned, dirs)
+		if err != nil {
+			util.LogAction(util.ACT_ERROR, "%v: unable to check newer versions for %v support: %v", pin.Path, base.GOOS(), err)
+			continue
+		}
+		if version == "" {
+			continue
+		}
+
+		util.LogAction(util.ACT_PIN, "%v: %v already builds on %v", pin.Path, version, base.GOOS())
+		pin.Native = version
+		for pidx := range out.Packages {
+			if out.Packages[pidx].Module == pin.Path {
+				out.Packages[pidx].Native = version
+			}
+		}
+	}
+}
+
+// Oldest released version newer than the given one where every package (folder of the module) has files
+// built specifically for the platform, empty if there is none
+func nativeVersion(modPath string, version string, dirs []string) (string, error) {
+	versions, err := util.GoListModVersions(modPath)
+	if err != nil {
+		return "", err
+	}
+
+	var newer []string
+	for _, v := range versions {
+		if semver.IsValid(version) && semver.Compare(v, version) > 0 && semver.Prerelease(v) == "" {
+			newer = append(newer, v)
+		}
+	}
+	if len(newer) == 0 {
+		return "", nil
+	}
+
+	if ok, err := buildsNatively(modPath, newer[len(newer)-1], dirs); !ok || err != nil {
+		return "", err
+	}
+
+	// Support is assumed to be kept once added, so only a few versions have to be downloaded
+	lo, hi := 0, len(newer)-1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		ok, err := buildsNatively(modPath, newer[mid], dirs)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return newer[hi], nil
+}
+
+// Whether every package of a module version has a file built specifically for the platform
+// (named after it or with a build constraint that mentions it)
+func buildsNatively(modPath string, version string, dirs []string) (bool, error) {
+	root, err := util.GoModDownloadDir(modPath, version)
+	if err != nil {
+		return false, err
+	}
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(dir)))
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		found := false
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+
+			src, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(dir), name))
+			if err != nil {
+				return false, err
+			}
+
+			switch cnstr := tags.Parse(name, src, base.GOOS(), base.GOARCH(), base.BuildTags).(type) {
+			case tags.Supported:
+				found = true
+			case tags.Platforms:
+				// Files are only for a single platform when named after it
+				found = len(cnstr) == 1 && cnstr[base.GOOS()]
+			}
+			if found {
+				break
+			}
+		}
+
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
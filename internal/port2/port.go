@@ -4,12 +4,13 @@
 package port2
 
 import (
-	"bytes"
 	"fmt"
 	"go/parser"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
+	"sort"
+	"strconv"
 
 	"github.com/zosopentools/wharf/internal/base"
 	"github.com/zosopentools/wharf/internal/pkg2"
@@ -64,13 +65,45 @@ func (ctx *Context) Port(pkg *pkg2.Package) (Result, error) {
 		if changed, err := ctx.pin(pkg.Meta.Module); err != nil {
 			return RESULT_ERROR, err
 		} else if changed {
+			pin := ctx.pins[pkg.Meta.Module.Path]
+			switch {
+			case pin.redirect != "":
+				handle.trace.Versions = append(handle.trace.Versions, pin.redirect+"@"+pin.pinTo)
+			case pin.patch != "":
+				handle.trace.Versions = append(handle.trace.Versions, pin.pinTo+" (patched with catalog patch "+pin.patch+")")
+			default:
+				handle.trace.Versions = append(handle.trace.Versions, pin.pinTo)
+			}
 			return RESULT_RELOAD, nil
 		}
 	}
 
 	baseId := handle.buildIdx
+	handle.portErrs = handle.errs
 	err := handle.port()
+
+	// If the package can't be ported automatically, fall back to the diffs given for its files
+	if perr, ok := err.(PatchError); ok {
+		if directives := ctx.directivesFor(pkg); directives != nil && len(directives.Files) > 0 {
+			if derr := handle.applyPackageDirective(baseId, directives.Files); derr != nil {
+				err = handle.fail(
+					fmt.Sprintf("%v (file directives failed: %v)", perr.Reason, derr),
+					"check the DIFF directives used for this package",
+				)
+			} else {
+				handle.exhausted = false
+				err = nil
+			}
+		}
+	}
+
 	if err != nil {
+		if _, ok := err.(PatchError); !ok {
+			err = handle.fail(err.Error(), "")
+		}
+		handle.err = err
+		handle.trace.Result = err.Error()
+		util.LogAction(util.ACT_ERROR, "%v: %v", pkg.Meta.ImportPath, err)
 		return RESULT_ERROR, err
 	}
 
@@ -84,9 +117,16 @@ func (ctx *Context) Port(pkg *pkg2.Package) (Result, error) {
 			pin.imported = true
 			ctx.pins[pkg.Meta.Module.Path] = pin
 		}
+		handle.trace.Result = "patched using config " + handle.configName(handle.buildIdx)
 		return RESULT_PATCHED, nil
 	}
 
+	if handle.valid {
+		handle.trace.Result = "no changes needed"
+	} else {
+		handle.trace.Result = "waiting on imported packages to be ported"
+	}
+
 	return RESULT_CONTINUE, err
 }
 
@@ -94,24 +134,58 @@ func (ctx *Context) pin(module *pkg2.Module) (bool, error) {
 	var err error
 	pin := ctx.pins[module.Path]
 
+	// Modules with a known fork are replaced by it (unless the workspace already replaces them),
+	// the fork is then ported like any other version of the module
+	if pin.redirect != "" {
+		return false, nil
+	}
+	if directives := base.InlinesFor(module.Path, module.Version); directives != nil && directives.Redirect != nil && module.Replace == nil && !pin.isPinned() {
+		redirect := directives.Redirect
+		if err = util.GoWorkEditReplace(module.Path, redirect.Path, redirect.Version); err != nil {
+			return false, fmt.Errorf("unable to redirect %v to %v@%v: %w", module.Path, redirect.Path, redirect.Version, err)
+		}
+
+		ctx.pins[module.Path] = versionPin{
+			version:  module.Version,
+			pinTo:    redirect.Version,
+			redirect: redirect.Path,
+		}
+		util.LogAction(util.ACT_PIN, "%v: redirected to %v@%v", module.Path, redirect.Path, redirect.Version)
+		return true, nil
+	}
+
 	// First lock the version the module will use (using the following process):
 	//
 	// 1. If the module can be updated we try locking it to the updated version
+	//    (or to each version found by the version search, see base.VersionSearch)
 	// 2. If we already tried the updated version then lock it to the original version determined by MVS
 	if module.Replace == nil || (pin.isPinned() && pin.pinTo != pin.version) {
 		pinTo := module.Version
+		var candidates []string
 
-		if !pin.isPinned() {
+		if !pin.isPinned() && base.VersionSearch != "" {
+			candidates, err = searchVersions(module)
+			if err != nil {
+				util.LogAction(util.ACT_ERROR, "%v: unable to search versions: %v", module.Path, err)
+			} else {
+				util.LogAction(util.ACT_PIN, "%v: searching %v newer version(s) (%v)", module.Path, len(candidates), base.VersionSearch)
+				base.NoteOffline("%v: searched the %v newer version(s) available offline", module.Path, len(candidates))
+			}
+			if len(candidates) > 0 {
+				pinTo, candidates = candidates[0], candidates[1:]
+			}
+		} else if !pin.isPinned() {
 			pinTo, err = util.GoListModUpdate(module.Path)
 			if err != nil && !pkg2.IsExcludeGoListError(err.Error()) {
 				return false, err
 			}
+			base.NoteOffline("%v: tried %v, the latest version available offline", module.Path, pinTo)
+		} else if len(pin.candidates) > 0 {
+			pinTo, candidates = pin.candidates[0], pin.candidates[1:]
 		}
 
-		if err = util.GoWorkEditReplaceVersion(
-			module.Path,
-			pinTo,
-		); err != nil {
+		patch, err := replaceVersion(module.Path, pinTo)
+		if err != nil {
 			return false, err
 		}
 
@@ -121,14 +195,22 @@ func (ctx *Context) pin(module *pkg2.Module) (bool, error) {
 		}
 
 		ctx.pins[module.Path] = versionPin{
-			version: module.Version,
-			pinTo:   pinTo,
+			version:    module.Version,
+			pinTo:      pinTo,
+			patch:      patch,
+			candidates: candidates,
 		}
 
 		if oldVer != pinTo {
+			util.LogAction(util.ACT_PIN, "%v: changed version from %v to %v", module.Path, oldVer, pinTo)
 			return true, err
 		}
+		util.LogAction(util.ACT_PIN, "%v: pinned to %v", module.Path, pinTo)
 
+		// The module now uses a patched copy of the version
+		if patch != "" {
+			return true, nil
+		}
 	}
 
 	return false, nil
@@ -144,22 +226,24 @@ func (handle *Handle) port() error {
 	needTag := handle.incomplete
 	handle.incomplete = false
 
+	// Errors caused by imports that can't be ported may still be fixed by inline directives
+	// if no config works, as long as the package doesn't need to change for anything else
+	canInline := !needTag
+	exhausted := make(map[*pkg2.Package]bool, 0)
+
 	var illList []pkg2.TypeError
 	for _, err := range handle.errs {
-		if iname, ok := err.Reason.(pkg2.TCBadImportName); ok {
-			ipkg := pkg.LookupImport(iname.PkgName, err.Err.Fset.Position(err.Err.Pos).Filename)
-
-			if ipkg == nil {
-				handle.panic(fmt.Sprintf("type check got %v but cannot identify import path for %v", err.Err, iname.PkgName))
-			}
+		if ipkg := handle.errorImport(err); ipkg != nil {
 			if handle.ctx.handles[ipkg].exhausted {
 				needTag = true
+				exhausted[ipkg] = true
 			} else {
 				imports[ipkg] = true
 			}
 
 		} else if _, ok := err.Reason.(pkg2.TCBadName); ok {
 			needTag = true
+			canInline = false
 		} else {
 			illList = append(illList, err)
 		}
@@ -173,7 +257,17 @@ func (handle *Handle) port() error {
 
 	// Never try porting a package with unknown type errors
 	if len(illList) > 0 {
-		return fmt.Errorf("unknown type error(s) occurred in %v: %v", pkg.Meta.ImportPath, illList)
+		handle.tried(handle.buildIdx, illList, "type errors other than missing definitions")
+		return handle.fail(
+			fmt.Sprintf("unknown type error(s) occurred in %v: %v", pkg.Meta.ImportPath, illList),
+			"the package needs porting by hand",
+		)
+	}
+
+	if len(handle.errs) > 0 {
+		handle.tried(handle.buildIdx, handle.errs, "has type errors")
+	} else {
+		handle.tried(handle.buildIdx, nil, "missing definitions used by parent packages")
 	}
 
 	// Have to do tagging
@@ -187,12 +281,7 @@ func (handle *Handle) port() error {
 
 			satisfied := true
 			for _, err := range errs {
-				if iname, ok := err.Reason.(pkg2.TCBadImportName); ok {
-					ipkg := pkg.LookupImport(iname.PkgName, err.Err.Fset.Position(err.Err.Pos).Filename)
-
-					if ipkg == nil {
-						handle.panic(fmt.Sprintf("type check got %v but cannot identify import path for %v", err.Err, iname.PkgName))
-					}
+				if ipkg := handle.errorImport(err); ipkg != nil {
 					imports[ipkg] = true
 				} else if !err.Err.Soft {
 					satisfied = false
@@ -205,16 +294,26 @@ func (handle *Handle) port() error {
 				handle.types = typed
 				handle.errs = errs
 
-				if handle.validate() {
+				if err := handle.validate(); err != nil {
+					handle.tried(build, errs, err.Error())
+				} else {
+					handle.tried(build, errs, "")
 					break
 				}
+			} else {
+				handle.tried(build, errs, "unresolvable type errors")
 			}
 			build++
 		}
 
-		if build >= len(pkg.Builds) {
+		if build >= len(pkg.Builds) && canInline {
+			imports = exhausted
+		} else if build >= len(pkg.Builds) {
 			handle.MarkExhausted()
-			return fmt.Errorf("unable to find a valid config")
+			return handle.fail(
+				"unable to find a valid config",
+				"none of the platform configs provide the missing definitions, the package needs porting by hand",
+			)
 		}
 	}
 
@@ -244,13 +343,17 @@ func (handle *Handle) port() error {
 		return nil
 	}
 
-	// Try retagging to remove the bad imports
-	fiEdits := make(fileImportEdits)
+	// Try retagging to remove the bad imports, keeping track of the inline directives
+	// that fix the errors of the current config in case no config works
+	fiEdits := newConfigEdits(handle.buildIdx)
+	for _, err := range handle.errs {
+		handle.collectInline(err, handle.buildIdx, fiEdits)
+	}
 	fiBuild := handle.buildIdx
 	build := handle.buildIdx + 1
 	for build < len(pkg.Builds) {
 		if fiEdits == nil {
-			fiEdits = make(fileImportEdits)
+			fiEdits = newConfigEdits(build)
 			fiBuild = build
 		}
 
@@ -259,28 +362,7 @@ func (handle *Handle) port() error {
 
 		satisfied := true
 		for _, err := range errs {
-			if info, ok := err.Reason.(pkg2.TCBadImportName); ok {
-				file := err.Err.Fset.Position(err.Err.Pos).Filename
-				ipkg := pkg.LookupImport(info.PkgName, file)
-				if ipkg == nil {
-					handle.panic(fmt.Sprintf("type check got %v but cannot identify import path for %v", err.Err, info.PkgName))
-				}
-
-				directives := base.Inlines[ipkg.Meta.ImportPath]
-				if directives != nil && directives.Exports != nil {
-					ed, ok := directives.Exports[info.Name.Name]
-					if ok {
-						if fiEdits[file] == nil {
-							fiEdits[file] = make(map[string]map[string]base.ExportInline)
-							fiEdits[file][info.PkgName] = make(map[string]base.ExportInline)
-						} else if fiEdits[file][info.PkgName] == nil {
-							fiEdits[file][info.PkgName] = make(map[string]base.ExportInline)
-						}
-
-						fiEdits[file][info.PkgName][info.Name.Name] = ed
-					}
-				}
-			}
+			handle.collectInline(err, build, fiEdits)
 
 			if !err.Err.Soft {
 				if fiBuild == build {
@@ -297,9 +379,14 @@ func (handle *Handle) port() error {
 			handle.types = typed
 			handle.errs = errs
 
-			if handle.validate() {
+			if err := handle.validate(); err != nil {
+				handle.tried(build, errs, err.Error())
+			} else {
+				handle.tried(build, errs, "")
 				break
 			}
+		} else {
+			handle.tried(build, errs, "unresolvable type errors")
 		}
 		build++
 	}
@@ -307,8 +394,11 @@ func (handle *Handle) port() error {
 	if build < len(pkg.Builds) {
 		handle.patched = true
 		return nil
-	} else if fiEdits == nil {
-		return fmt.Errorf("unable to find a valid config")
+	} else if fiEdits == nil || fiEdits.empty() {
+		return handle.fail(
+			"unable to find a valid config",
+			"add EXPORT/CONST directives for the missing definitions of imported packages, or CONVERT directives for the ones with mismatched types",
+		)
 	}
 
 	pkgCacheDir := filepath.Join(base.Cache, pkg.Meta.ImportPath)
@@ -324,36 +414,38 @@ func (handle *Handle) port() error {
 
 	typed, errs := handle.typeCheck(len(pkg.Builds)-1, defaultTypeConfig())
 	if len(errs) > 0 {
+		handle.tried(len(pkg.Builds)-1, errs, "inline edits left type errors")
 		handle.MarkExhausted()
-		return fmt.Errorf("inline edits resulted in a bad config")
+		return handle.fail(
+			"inline edits resulted in a bad config",
+			"check the EXPORT/CONST/CONVERT directives used for this package",
+		)
 	}
 
 	handle.types = typed
-	handle.buildIdx = fiBuild
+	// The inline edits were added as a new config, it is the one patches are collected from
+	handle.buildIdx = len(pkg.Builds) - 1
 
 	// Verify the config
-	if handle.validate() {
+	if err := handle.validate(); err != nil {
+		handle.tried(len(pkg.Builds)-1, errs, err.Error())
+	} else {
+		handle.tried(len(pkg.Builds)-1, errs, "")
 		handle.patched = true
 		return nil
 	}
 
-	// We couldn't find a working config, so we try and see if we can fix the package using explicit handlers
-	//
-	// TODO: RE-IMPLEMENT THIS
-	// if handler := base.Inlines[pkg.Meta.ImportPath]; handler != nil && handler.Files != nil {
-	// 	err := c.applyPackageDirective(pkg, pkgCacheDir, handler.Files)
-	// 	// TODO: report on diff failing
-	// 	if err == nil {
-	// 		state.ps = psPatched
-	// 		return nil
-	// 	}
-	// }
-
 	handle.MarkExhausted()
-	return fmt.Errorf("no applicable options available to port package %v", pkg.Meta.ImportPath)
+	return handle.fail(
+		fmt.Sprintf("no applicable options available to port package %v", pkg.Meta.ImportPath),
+		"the package needs porting by hand",
+	)
 }
 
-func (handle *Handle) validate() bool {
+// Check that the parents of a package still type check against the selected config
+//
+// Returns the reason the config breaks a parent package
+func (handle *Handle) validate() error {
 	pkg := handle.pkg
 	for _, parent := range pkg.Parents {
 		ph := handle.ctx.handles[parent]
@@ -364,8 +456,15 @@ func (handle *Handle) validate() bool {
 
 		for _, err := range errs {
 			// We only care about errors from local imports
-			if info, ok := err.Reason.(pkg2.TCBadImportName); ok {
-				ipath, ok := parent.Files[err.Err.Fset.Position(err.Err.Pos).Filename].Imports[info.PkgName]
+			if info, ok := err.Reason.(pkg2.TCMismatch); ok {
+				if pkg.Meta.ImportPath == info.Path {
+					return fmt.Errorf("breaks parent package %v: %v", parent.Meta.ImportPath, err.Error())
+				}
+			} else if info, ok := err.Reason.(pkg2.TCBadImportName); ok {
+				ipath, ok := info.Path, info.Path != ""
+				if !ok {
+					ipath, ok = parent.Files[err.Err.Fset.Position(err.Err.Pos).Filename].Imports[info.PkgName]
+				}
 				if !ok {
 					if backup := pkg2.BackupNameLookup(info.PkgName); backup != nil {
 						ipath = backup.Meta.ImportPath
@@ -377,7 +476,7 @@ func (handle *Handle) validate() bool {
 				// If we have a match then that means the parents failed because of
 				// of the package under test, therefore we have a bad build
 				if pkg.Meta.ImportPath == ipath {
-					return false
+					return fmt.Errorf("breaks parent package %v: %v", parent.Meta.ImportPath, err.Error())
 				}
 			} else if !err.Err.Soft {
 				// TODO: handle gracefully (allow cleanup)
@@ -392,14 +491,230 @@ func (handle *Handle) validate() bool {
 		}
 	}
 
-	return true
+	return nil
+}
+
+// Find the imported package a type error is caused by, nil if it isn't caused by an import
+func (handle *Handle) errorImport(err pkg2.TypeError) *pkg2.Package {
+	file := err.Err.Fset.Position(err.Err.Pos).Filename
+
+	switch reason := err.Reason.(type) {
+	case pkg2.TCBadImportName:
+		ipkg := handle.pkg.LookupImport(reason.PkgName, file)
+		if ipkg == nil {
+			handle.panic(fmt.Sprintf("type check got %v but cannot identify import path for %v", err.Err, reason.PkgName))
+		}
+		return ipkg
+	case pkg2.TCBadName:
+		// Names can be missing from dot imported packages
+		if reason.MemberOf == nil {
+			if ipkg, _, ok := handle.dotImportDirective(file, reason.Name); ok {
+				return ipkg
+			}
+		}
+	case pkg2.TCMismatch:
+		// Mismatches can come from packages the file doesn't import (eg. the type of a field)
+		if ipkg := handle.pkg.Imports[reason.Path]; ipkg != nil {
+			return ipkg
+		}
+		return handle.pkg.LookupImport(reason.PkgName, file)
+	}
+	return nil
+}
+
+// Find the export directive for an undeclared name of a file among the packages the file dot imports
+func (handle *Handle) dotImportDirective(file string, name string) (*pkg2.Package, base.ExportInline, bool) {
+	gofile := handle.pkg.Files[file]
+	if gofile == nil || gofile.Syntax == nil {
+		return nil, base.ExportInline{}, false
+	}
+
+	for _, spec := range gofile.Syntax.Imports {
+		if spec.Name == nil || spec.Name.Name != DOT_IMPORT_NAME {
+			continue
+		}
+		ipath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		ipkg := handle.pkg.Imports[ipath]
+		if ipkg == nil {
+			continue
+		}
+
+		if directives := handle.ctx.directivesFor(ipkg); directives != nil {
+			if ed, ok := directives.Exports[name]; ok && ed.Type != base.InlineConvertSym {
+				return ipkg, ed, true
+			}
+		}
+	}
+
+	return nil, base.ExportInline{}, false
 }
 
 // File Name -> Import Name -> Symbol Name -> Directive
 type fileImportEdits map[string]map[string]map[string]base.ExportInline
 
+// Inline directives to apply to the files of a config
+type configEdits struct {
+	// Config the conversions were found in
+	build int
+
+	exports fileImportEdits
+
+	// File Name -> Values to convert
+	conversions map[string][]pkg2.TCMismatch
+
+	// Stub Name -> Definition to declare a stub for
+	stubs map[string]*stubDecl
+}
+
+func newConfigEdits(build int) *configEdits {
+	return &configEdits{
+		build:       build,
+		exports:     make(fileImportEdits),
+		conversions: make(map[string][]pkg2.TCMismatch),
+		stubs:       make(map[string]*stubDecl),
+	}
+}
+
+func (edits *configEdits) empty() bool {
+	return len(edits.exports) == 0 && len(edits.conversions) == 0
+}
+
+// Changes made to a file copied to the cache
+type fileEdits struct {
+	// Import Name -> Symbol Name -> Directive
+	Exports map[string]map[string]base.ExportInline
+
+	Conversions []base.SymbolRepl
+}
+
+// Record the inline directive that fixes a type error found in a config, if there is one
+func (handle *Handle) collectInline(err pkg2.TypeError, build int, edits *configEdits) {
+	file := err.Err.Fset.Position(err.Err.Pos).Filename
+
+	switch reason := err.Reason.(type) {
+	case pkg2.TCBadName:
+		if reason.MemberOf != nil {
+			return
+		}
+		ipkg, ed, ok := handle.dotImportDirective(file, reason.Name)
+		if !ok {
+			return
+		}
+
+		symbol := ipkg.Meta.ImportPath + "." + reason.Name
+		if ed.Type == base.InlineStubSym {
+			if ed, ok = handle.collectStub(symbol, ipkg, reason, edits); !ok {
+				return
+			}
+		}
+
+		handle.considered(fmt.Sprintf("%v: %v %v", symbol, ed.Type, ed.Replace))
+		if edits.exports[file] == nil {
+			edits.exports[file] = make(map[string]map[string]base.ExportInline)
+		}
+		if edits.exports[file][DOT_IMPORT_NAME] == nil {
+			edits.exports[file][DOT_IMPORT_NAME] = make(map[string]base.ExportInline)
+		}
+		edits.exports[file][DOT_IMPORT_NAME][reason.Name] = ed
+
+	case pkg2.TCBadImportName:
+		ipkg := handle.errorImport(err)
+		name := reason.Name.Name
+		if reason.Name.MemberOf != nil {
+			name = *reason.Name.MemberOf + "." + name
+		}
+		symbol := ipkg.Meta.ImportPath + "." + name
+
+		var ed base.ExportInline
+		directives := handle.ctx.directivesFor(ipkg)
+		if directives != nil {
+			ed = directives.Exports[name]
+		}
+
+		switch {
+		case ed.Type == base.InlineStubSym:
+			ok := false
+			if ed, ok = handle.collectStub(symbol, ipkg, reason.Name, edits); !ok {
+				return
+			}
+		case ed.Type == "" || ed.Type == base.InlineConvertSym:
+			if !base.Stubs {
+				handle.considered(symbol + ": no inline directive")
+				return
+			}
+			// Fall back to a stub when nothing else provides the definition
+			ok := false
+			if ed, ok = handle.collectStub(symbol, ipkg, reason.Name, edits); !ok {
+				return
+			}
+		}
+
+		handle.considered(fmt.Sprintf("%v: %v %v", symbol, ed.Type, ed.Replace))
+		if edits.exports[file] == nil {
+			edits.exports[file] = make(map[string]map[string]base.ExportInline)
+		}
+		if edits.exports[file][reason.PkgName] == nil {
+			edits.exports[file][reason.PkgName] = make(map[string]base.ExportInline)
+		}
+		edits.exports[file][reason.PkgName][name] = ed
+
+	case pkg2.TCMismatch:
+		name := reason.Name.Name
+		if reason.Name.MemberOf != nil {
+			name = *reason.Name.MemberOf + "." + name
+		}
+		symbol := reason.Path + "." + name
+
+		var directives *base.PackageInline
+		if ipkg := handle.pkg.Imports[reason.Path]; ipkg != nil {
+			directives = handle.ctx.directivesFor(ipkg)
+		} else {
+			directives = base.InlinesFor(reason.Path, "")
+		}
+		if directives == nil {
+			handle.considered(symbol + ": no inline directives")
+			return
+		}
+		if ed, ok := directives.Exports[name]; !ok || ed.Type != base.InlineConvertSym {
+			handle.considered(symbol + ": no CONVERT directive")
+			return
+		}
+		if reason.Want == "" {
+			handle.considered(symbol + ": CONVERT (value cannot be converted)")
+			return
+		}
+
+		handle.considered(fmt.Sprintf("%v: CONVERT to %v", symbol, reason.Want))
+
+		// Conversions are placed using the syntax of the config they were found in
+		if build == edits.build {
+			edits.conversions[file] = append(edits.conversions[file], reason)
+		}
+	}
+}
+
+// Record the stub to declare for a definition missing from an imported package
+//
+// Returns the directive that replaces the references with the stub, false if no stub can be declared
+func (handle *Handle) collectStub(symbol string, ipkg *pkg2.Package, name pkg2.TCBadName, edits *configEdits) (base.ExportInline, bool) {
+	stub, err := handle.stubFor(ipkg, name)
+	if err != nil {
+		handle.considered(fmt.Sprintf("%v: %v (%v)", symbol, base.InlineStubSym, err))
+		return base.ExportInline{}, false
+	}
+
+	sname := stubName(ipkg, stub.symbol)
+	edits.stubs[sname] = stub
+	return base.ExportInline{Type: base.InlineStubSym, Replace: sname}, true
+}
+
 // Apply export directives to a package based on the
-func (handle *Handle) applyExportDirective(build int, cache string, fiEdits fileImportEdits) error {
+//
+// The changed files are copied to the cache and added to a new config
+func (handle *Handle) applyExportDirective(build int, cache string, edits *configEdits) error {
 	pkg := handle.pkg
 	ccfg := pkg.Builds[build]
 	pcfg := pkg2.BuildConfig{
@@ -407,38 +722,43 @@ func (handle *Handle) applyExportDirective(build int, cache string, fiEdits file
 		Files:     make([]*pkg2.GoFile, 0, len(ccfg.Files)),
 	}
 
+	// Resolve the references to the symbols being replaced
+	_, _, info := handle.typeCheckInfo(build, defaultTypeConfig())
+
 	// Apply the changes and make copies of files, store files in cache
 	for idx := range ccfg.Files {
 		gofile := ccfg.Files[idx]
 
-		iEdits := fiEdits[gofile.Name]
-		if iEdits == nil {
+		iEdits := edits.exports[gofile.Name]
+		conversions := edits.conversions[gofile.Name]
+		if iEdits == nil && conversions == nil {
 			pcfg.Files = append(pcfg.Files, gofile)
 			pcfg.Syntax = append(pcfg.Syntax, ccfg.Syntax[idx])
 			continue
 		}
 
-		file, err := os.ReadFile(filepath.Join(pkg.Meta.Dir, gofile.Name))
+		file, err := os.ReadFile(gofile.Path)
 		if err != nil {
 			// TODO: better info
 			return fmt.Errorf("unable to read file for custom import replacement: %w", err)
 		}
 
 		cpath := filepath.Join(cache, gofile.Name)
+		reason := fileEdits{Exports: iEdits}
 
+		// Edits are made to the references the type checker resolved, leaving the rest of the file as is
+		splices, converted := conversionSplices(file, conversions)
+		splices = append(splices, exportSplices(ccfg.Syntax[idx], info, iEdits)...)
+		file = applySplices(file, splices)
+		reason.Conversions = converted
+
+		for _, conv := range converted {
+			util.LogAction(util.ACT_EXPORT, "%v: %v: replaced %v with %v (%v)", pkg.Meta.ImportPath, gofile.Name, conv.Original, conv.New, base.InlineConvertSym)
+		}
 		for iname, sEdits := range iEdits {
 			for sname, ed := range sEdits {
-				var repstr string
-				switch ed.Type {
-				case base.InlineExportSym:
-					repstr = iname + "." + ed.Replace
-				case base.InlineConstSym:
-					repstr = ed.Replace
-				default:
-					panic("unknown export directive type")
-				}
-				// TODO: handle cases where import name is "."
-				file = bytes.ReplaceAll(file, ([]byte)(iname+"."+sname), ([]byte)(repstr))
+				original, repstr := exportReplacement(iname, sname, ed)
+				util.LogAction(util.ACT_EXPORT, "%v: %v: replaced %v with %v (%v)", pkg.Meta.ImportPath, gofile.Name, original, repstr, ed.Type)
 			}
 		}
 
@@ -455,7 +775,7 @@ func (handle *Handle) applyExportDirective(build int, cache string, fiEdits file
 		}
 
 		repl := &pkg2.GoFile{
-			Name:    fmt.Sprintf("%v_%v.go", strings.TrimSuffix(gofile.Name, ".go"), base.GOOS()),
+			Name:    tags.TargetFileName(gofile.Name, base.GOOS()),
 			Path:    cpath,
 			Cgo:     gofile.Cgo,
 			Syntax:  syntax,
@@ -463,7 +783,7 @@ func (handle *Handle) applyExportDirective(build int, cache string, fiEdits file
 			Imports: gofile.Imports,
 			Replaced: &pkg2.ReplacedFile{
 				File:   gofile,
-				Reason: iEdits,
+				Reason: reason,
 			},
 		}
 
@@ -471,78 +791,207 @@ func (handle *Handle) applyExportDirective(build int, cache string, fiEdits file
 		pcfg.Syntax = append(pcfg.Syntax, syntax)
 	}
 
+	// Declare the stubs the references were replaced with in a file of their own
+	if len(edits.stubs) > 0 {
+		src, declared, err := handle.stubSource(edits.stubs)
+		if err != nil {
+			return err
+		}
+
+		name := tags.TargetFileName(STUB_FILE_NAME, base.GOOS())
+		stubFile := &pkg2.GoFile{
+			Name: name,
+			Path: filepath.Join(cache, name),
+			Replaced: &pkg2.ReplacedFile{
+				Reason: declared,
+			},
+		}
+		if err := os.WriteFile(stubFile.Path, src, 0740); err != nil {
+			return fmt.Errorf("unable to write stubs: %w", err)
+		}
+		if err := pkg2.LoadGoFile(stubFile); err != nil {
+			return fmt.Errorf("unable to parse stubs: %w", err)
+		}
+		stubFile.Tags = tags.Supported{}
+
+		for _, symbol := range declared.Symbols {
+			util.LogAction(util.ACT_EXPORT, "%v: %v: declared stub %v for %v", pkg.Meta.ImportPath, name, symbol.New, symbol.Original)
+		}
+
+		pcfg.Files = append(pcfg.Files, stubFile)
+		pcfg.Syntax = append(pcfg.Syntax, stubFile.Syntax)
+	}
+
 	pkg.Builds = append(pkg.Builds, pcfg)
 	return nil
 }
 
-// Apply a package's file directives to the package's source and attempt a build
-// func (c *Controller) applyPackageDirective(pkg *pkg2.Package, cache string, directives map[string]base.FileInline) error {
-// 	state := c.states[pkg]
-// 	pcfg := pkg2.BuildConfig{
-// 		Platforms: []string{},
-// 		Files:     make([]*pkg2.GoFile, 0, len(pkg.Builds[0].Files)),
-// 	}
-
-// 	for name, fh := range directives {
-// 		switch fh.Type {
-// 		case base.InlineDiffSym:
-// 			gofile := pkg.Files[name]
-// 			// Load diff file contents
-// 			diff, err := util.ReadFile(fh.Path)
-// 			if err != nil {
-// 				return fmt.Errorf("unable to read patch file: %w", err)
-// 			}
-
-// 			cpath := filepath.Join(cache, name)
-
-// 			// Apply patch
-// 			err = util.Patch(filepath.Join(pkg.Meta.Dir, name), cpath, diff)
-// 			if err != nil {
-// 				return fmt.Errorf("unable to apply patch: %w", err)
-// 			}
-
-// 			// Create AST for file
-// 			syntax, err := parser.ParseFile(pkg.FileSet, cpath, nil, parser.AllErrors)
-// 			if err != nil {
-// 				return fmt.Errorf("unable to parse patched file: %w", err)
-// 			}
-
-// 			repl := &pkg2.GoFile{
-// 				Name:    fmt.Sprintf("%v_%v.go", strings.TrimSuffix(gofile.Name, ".go"), base.GOOS()),
-// 				Path:    cpath,
-// 				Cgo:     gofile.Cgo,
-// 				Syntax:  syntax,
-// 				Imports: gofile.Imports,
-// 				Replaced: &pkg2.ReplacedFile{
-// 					File:   gofile,
-// 					Reason: "internal patch description",
-// 				},
-// 			}
-// 			pcfg.Files = append(pcfg.Files, repl)
-// 			pcfg.Syntax = append(pcfg.Syntax, syntax)
-// 		default:
-// 			panic("Unknown explicit file handler type")
-// 		}
-// 	}
-
-// 	// Add unchanged files from base config to the patched config
-// 	// TODO: what if we patch files not from the base config?
-// 	for idx, gofile := range pkg.Files {
-// 		pcfg.Files = append(pcfg.Files, gofile)
-// 		if overlay := pcfg.Override[gofile.Name]; overlay != nil {
-// 			pcfg.Syntax = append(pcfg.Syntax, overlay.Syntax)
-// 		} else {
-// 			pcfg.Syntax = append(pcfg.Syntax, pkg.Builds[0].Syntax[idx])
-// 		}
-// 	}
-
-// 	pkg.Builds = append(pkg.Builds, pcfg)
-// 	state.cfi = len(pkg.Builds) - 1
-
-// 	if c.validate(pkg, nil) {
-// 		return nil
-// 	}
-
-// 	state.cfi = len(pkg.Builds)
-// 	return fmt.Errorf("patched package resulted in badly typed package")
-// }
+// Diff applied to a file copied to (or created in) the cache
+type fileDiff struct {
+	Path string
+}
+
+// Apply a package's file directives to the files of a config, and select the result if it builds
+//
+// The patched files are written to the cache and added to a new config, which must not break the parents of the package
+func (handle *Handle) applyPackageDirective(build int, directives map[string]base.FileInline) error {
+	pkg := handle.pkg
+	cache := filepath.Join(base.Cache, pkg.Meta.ImportPath)
+	if err := os.MkdirAll(cache, 0740); err != nil {
+		return fmt.Errorf("unable to create cache directory for package: %w", err)
+	}
+	if err := pkg.LoadSyntax(build); err != nil {
+		return err
+	}
+
+	// Patch files in a fixed order so every run produces the same config
+	names := make([]string, 0, len(directives))
+	for name := range directives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	patched := make(map[string]*pkg2.GoFile, len(names))
+	for _, name := range names {
+		fd := directives[name]
+		handle.considered(fmt.Sprintf("%v/%v: %v %v", pkg.Meta.ImportPath, name, fd.Type, fd.Path))
+		if fd.Type != base.InlineDiffSym {
+			return fmt.Errorf("%v: unknown file directive type %v", name, fd.Type)
+		}
+
+		gofile, err := handle.applyDiff(cache, name, fd.Path)
+		if err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		patched[name] = gofile
+		util.LogAction(util.ACT_EXPORT, "%v: %v: patched with %v", pkg.Meta.ImportPath, name, fd.Path)
+	}
+
+	ccfg := pkg.Builds[build]
+	pcfg := pkg2.BuildConfig{
+		Platforms: []string{base.GOOS()},
+		Files:     make([]*pkg2.GoFile, 0, len(ccfg.Files)+len(patched)),
+	}
+	for idx, gofile := range ccfg.Files {
+		if repl := patched[gofile.Name]; repl != nil {
+			delete(patched, gofile.Name)
+			pcfg.Files = append(pcfg.Files, repl)
+			pcfg.Syntax = append(pcfg.Syntax, repl.Syntax)
+		} else {
+			pcfg.Files = append(pcfg.Files, gofile)
+			pcfg.Syntax = append(pcfg.Syntax, ccfg.Syntax[idx])
+		}
+	}
+	// Created files and files that were not part of the config
+	for _, name := range names {
+		if repl := patched[name]; repl != nil {
+			pcfg.Files = append(pcfg.Files, repl)
+			pcfg.Syntax = append(pcfg.Syntax, repl.Syntax)
+		}
+	}
+
+	pkg.Builds = append(pkg.Builds, pcfg)
+	pbuild := len(pkg.Builds) - 1
+
+	typed, errs := handle.typeCheck(pbuild, defaultTypeConfig())
+	if len(errs) > 0 {
+		handle.tried(pbuild, errs, "file directives left type errors")
+		return fmt.Errorf("patched package has type errors: %v", errs[0].Error())
+	}
+
+	prevIdx, prevTypes, prevErrs := handle.buildIdx, handle.types, handle.errs
+	handle.buildIdx, handle.types, handle.errs = pbuild, typed, errs
+	if err := handle.validate(); err != nil {
+		handle.tried(pbuild, errs, err.Error())
+		handle.buildIdx, handle.types, handle.errs = prevIdx, prevTypes, prevErrs
+		return err
+	}
+
+	handle.tried(pbuild, errs, "")
+	handle.patched = true
+	return nil
+}
+
+// Apply the changes a diff makes to a file of the package, or create the file, in the cache
+func (handle *Handle) applyDiff(cache string, name string, diffPath string) (*pkg2.GoFile, error) {
+	pkg := handle.pkg
+	diff, err := util.ReadFile(diffPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read diff: %w", err)
+	}
+
+	// Diffs are usually made from the root of the repository, so the file is matched by its path in the module
+	rel, subdir := pkg.Meta.ImportPath, ""
+	if pkg.Meta.Module != nil {
+		if mrel, err := filepath.Rel(pkg.Meta.Module.Dir, pkg.Meta.Dir); err == nil {
+			rel = filepath.ToSlash(mrel)
+		}
+		_, subdir = util.SplitModulePath(pkg.Meta.Module.Path)
+	}
+
+	// The name alone would match the files of every package, packages at the root of a module
+	// are matched by their exact path in the repository instead
+	var dfile *util.DiffFile
+	if rel != "." {
+		dfile, err = util.DiffSection(diff, path.Join(rel, name), false)
+	} else if subdir != "" {
+		dfile, err = util.DiffSection(diff, path.Join(subdir, name), true)
+	}
+	if err == nil && dfile == nil {
+		// Diffs made from the folder of the package name the file alone
+		dfile, err = util.DiffSection(diff, name, true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", diffPath, err)
+	} else if dfile == nil {
+		return nil, fmt.Errorf("%v has no changes to the file", diffPath)
+	}
+	section, created := dfile.Section, dfile.Created
+
+	gofile := &pkg2.GoFile{
+		Name: name,
+		Path: filepath.Join(cache, name),
+		Replaced: &pkg2.ReplacedFile{
+			Reason: fileDiff{Path: diffPath},
+		},
+	}
+
+	target := ""
+	orig := pkg.Files[name]
+	switch {
+	case created && orig != nil:
+		return nil, fmt.Errorf("%v creates a file the package already has", diffPath)
+	case created:
+		// The created file is used as is, so it must already be built for the platform
+		if cnstr, ok := tags.ParseFileName(name, base.GOARCH()); !ok || (cnstr != nil && cnstr.Tag != base.GOOS()) {
+			return nil, fmt.Errorf("%v creates a file that is not built for %v/%v", diffPath, base.GOOS(), base.GOARCH())
+		}
+	case orig == nil:
+		return nil, fmt.Errorf("%v changes a file the package doesn't have", diffPath)
+	default:
+		target = orig.Path
+		gofile.Name = tags.TargetFileName(name, base.GOOS())
+		gofile.Replaced.File = orig
+	}
+
+	if err := util.Patch(target, gofile.Path, section); err != nil {
+		return nil, fmt.Errorf("unable to apply %v: %w", diffPath, err)
+	}
+	if err := pkg2.LoadGoFile(gofile); err != nil {
+		return nil, fmt.Errorf("unable to parse patched file: %w", err)
+	}
+	gofile.Tags = tags.Supported{}
+
+	// Packages are only type checked against the imports go list found
+	imports := append([]string{}, gofile.AnonImports...)
+	for _, ipath := range gofile.Imports {
+		imports = append(imports, ipath)
+	}
+	for _, ipath := range imports {
+		if pkg.Imports[ipath] == nil && ipath != pkg2.UNSAFE_PACKAGE_NAME && ipath != pkg2.CGO_PACKAGE_NAME {
+			return nil, fmt.Errorf("%v adds import %q, which the package doesn't import", diffPath, ipath)
+		}
+	}
+
+	return gofile, nil
+}
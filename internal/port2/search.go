@@ -0,0 +1,50 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"fmt"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/pkg2"
+	"github.com/zosopentools/wharf/internal/util"
+	"golang.org/x/mod/semver"
+)
+
+// Versions of a module to try before porting it, in the order given by base.VersionSearch
+//
+// Only released versions newer than the one selected by MVS are tried, older ones would not meet the
+// requirements of the modules that depend on it
+func searchVersions(module *pkg2.Module) ([]string, error) {
+	versions, err := util.GoListModVersions(module.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !semver.IsValid(module.Version) {
+		return nil, fmt.Errorf("invalid version %q", module.Version)
+	}
+
+	var candidates []string
+	for _, version := range versions {
+		if semver.Prerelease(version) != "" {
+			continue
+		}
+		if semver.Compare(version, module.Version) <= 0 {
+			continue
+		}
+		if base.SameMajor && semver.Major(version) != semver.Major(module.Version) {
+			continue
+		}
+		candidates = append(candidates, version)
+	}
+
+	// Versions are listed oldest first
+	if base.VersionSearch == base.VERSION_SEARCH_NEWEST {
+		for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+	}
+	return candidates, nil
+}
@@ -0,0 +1,399 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/pkg2"
+)
+
+// Prefix of the names stubs are declared as
+const STUB_PREFIX = "wharf_"
+
+// File the stubs of a package are declared in (named for the platform)
+const STUB_FILE_NAME = "wharf_stubs.go"
+
+// Platform the signatures of stubs are taken from
+const STUB_SOURCE_GOOS = "linux"
+
+// A definition of an imported package that is declared as a stub in the package using it
+type stubDecl struct {
+	ipkg *pkg2.Package
+
+	// Name of the definition in the imported package (methods are named like Termios.Foo)
+	symbol string
+
+	// Definition in the linux version of the imported package
+	obj types.Object
+}
+
+// Stubs declared in a file generated in the cache
+type fileStubs struct {
+	Symbols []base.SymbolRepl
+
+	// Stubs of functions that panic when called, as they can't return an error
+	Panics []string
+}
+
+// Name a stub of a definition is declared as
+func stubName(ipkg *pkg2.Package, symbol string) string {
+	return STUB_PREFIX + ipkg.Meta.Name + "_" + strings.ReplaceAll(symbol, ".", "_")
+}
+
+// Find the linux definition of a name missing from an imported package, to declare a stub for it
+func (handle *Handle) stubFor(ipkg *pkg2.Package, name pkg2.TCBadName) (*stubDecl, error) {
+	linux, err := handle.ctx.linuxTypes(ipkg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the %v version of the package: %w", STUB_SOURCE_GOOS, err)
+	}
+
+	stub := &stubDecl{ipkg: ipkg, symbol: name.Name}
+	if name.MemberOf == nil {
+		stub.obj = linux.Scope().Lookup(name.Name)
+	} else {
+		stub.symbol = *name.MemberOf + "." + name.Name
+		if tn, ok := linux.Scope().Lookup(*name.MemberOf).(*types.TypeName); ok {
+			stub.obj, _, _ = types.LookupFieldOrMethod(tn.Type(), true, linux, name.Name)
+		}
+	}
+
+	var used []types.Type
+	switch obj := stub.obj.(type) {
+	case nil:
+		return nil, fmt.Errorf("not defined on %v", STUB_SOURCE_GOOS)
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		if sig.TypeParams().Len() > 0 {
+			return nil, fmt.Errorf("generic functions can't be stubbed")
+		}
+		for idx := 0; idx < sig.Params().Len(); idx++ {
+			used = append(used, sig.Params().At(idx).Type())
+		}
+		for idx := 0; idx < sig.Results().Len(); idx++ {
+			used = append(used, sig.Results().At(idx).Type())
+		}
+	case *types.Const:
+		// A value from linux is a different, valid value on other platforms (eg. errno and signal numbers)
+		return nil, fmt.Errorf("constants can't be stubbed, their value differs between platforms (use a CONST directive)")
+	case *types.Var:
+		if obj.IsField() {
+			return nil, fmt.Errorf("fields can't be stubbed")
+		}
+		used = append(used, obj.Type())
+	default:
+		return nil, fmt.Errorf("only functions, methods and variables can be stubbed")
+	}
+
+	for _, typ := range used {
+		if err := handle.checkStubType(typ); err != nil {
+			return nil, err
+		}
+	}
+	return stub, nil
+}
+
+// Check that a stub can use a type: every named type must exist on the platform, in a package the package imports
+func (handle *Handle) checkStubType(typ types.Type) error {
+	switch t := typ.(type) {
+	case *types.Basic:
+		if t.Kind() == types.Invalid {
+			return fmt.Errorf("uses a type that is not defined on %v", STUB_SOURCE_GOOS)
+		}
+		if t.Kind() == types.UnsafePointer && handle.importedTypes(pkg2.UNSAFE_PACKAGE_NAME) == nil {
+			return fmt.Errorf("uses package unsafe, which %v doesn't import", handle.pkg.Meta.ImportPath)
+		}
+	case *types.Pointer:
+		return handle.checkStubType(t.Elem())
+	case *types.Slice:
+		return handle.checkStubType(t.Elem())
+	case *types.Array:
+		return handle.checkStubType(t.Elem())
+	case *types.Chan:
+		return handle.checkStubType(t.Elem())
+	case *types.Map:
+		if err := handle.checkStubType(t.Key()); err != nil {
+			return err
+		}
+		return handle.checkStubType(t.Elem())
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for idx := 0; idx < tuple.Len(); idx++ {
+				if err := handle.checkStubType(tuple.At(idx).Type()); err != nil {
+					return err
+				}
+			}
+		}
+	case *types.Struct:
+		for idx := 0; idx < t.NumFields(); idx++ {
+			if err := handle.checkStubType(t.Field(idx).Type()); err != nil {
+				return err
+			}
+		}
+	case *types.Interface:
+		for idx := 0; idx < t.NumEmbeddeds(); idx++ {
+			if err := handle.checkStubType(t.EmbeddedType(idx)); err != nil {
+				return err
+			}
+		}
+		for idx := 0; idx < t.NumExplicitMethods(); idx++ {
+			if err := handle.checkStubType(t.ExplicitMethod(idx).Type()); err != nil {
+				return err
+			}
+		}
+	case *types.Named:
+		obj := t.Obj()
+		if obj.Pkg() == nil {
+			return nil
+		}
+		if t.TypeArgs().Len() > 0 {
+			return fmt.Errorf("uses generic type %v", obj.Name())
+		}
+		if !obj.Exported() {
+			return fmt.Errorf("uses unexported type %v.%v", obj.Pkg().Name(), obj.Name())
+		}
+		typed := handle.importedTypes(obj.Pkg().Path())
+		if typed == nil {
+			return fmt.Errorf("uses package %v, which %v doesn't import", obj.Pkg().Path(), handle.pkg.Meta.ImportPath)
+		}
+		if _, ok := typed.Scope().Lookup(obj.Name()).(*types.TypeName); !ok {
+			return fmt.Errorf("uses %v.%v, which is not defined on %v", obj.Pkg().Name(), obj.Name(), base.GOOS())
+		}
+	default:
+		return fmt.Errorf("uses unsupported type %v", typ)
+	}
+	return nil
+}
+
+// Types of a package imported by the package, as type checked for the platform
+func (handle *Handle) importedTypes(path string) *types.Package {
+	if path == pkg2.UNSAFE_PACKAGE_NAME {
+		return types.Unsafe
+	}
+	ipkg := handle.pkg.Imports[path]
+	if ipkg == nil || handle.ctx.handles[ipkg] == nil {
+		return nil
+	}
+	return handle.ctx.handles[ipkg].types
+}
+
+// Type check the linux version of an imported package, the signatures of stubs are taken from it
+//
+// Only declarations are checked, imports that aren't loaded are replaced with empty packages
+func (ctx *Context) linuxTypes(ipkg *pkg2.Package) (*types.Package, error) {
+	if typed, ok := ctx.linux[ipkg]; ok {
+		return typed, nil
+	}
+
+	bctx := build.Default
+	bctx.GOOS = STUB_SOURCE_GOOS
+	bctx.GOARCH = base.GOARCH()
+	bctx.CgoEnabled = false
+	for tag := range base.BuildTags {
+		bctx.BuildTags = append(bctx.BuildTags, tag)
+	}
+
+	bpkg, err := bctx.ImportDir(ipkg.Meta.Dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*ast.File, 0, len(bpkg.GoFiles))
+	for _, name := range bpkg.GoFiles {
+		syntax, err := parser.ParseFile(pkg2.FileSet, filepath.Join(ipkg.Meta.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, syntax)
+	}
+
+	cfg := &types.Config{
+		IgnoreFuncBodies: true,
+		FakeImportC:      true,
+		Error:            func(error) {},
+		Importer: (importer)(func(path string) (*types.Package, error) {
+			if path == pkg2.UNSAFE_PACKAGE_NAME {
+				return types.Unsafe, nil
+			}
+			if dep := ipkg.Imports[path]; dep != nil && ctx.handles[dep] != nil && ctx.handles[dep].types != nil {
+				return ctx.handles[dep].types, nil
+			}
+			name, _ := pkg2.ImportPathToAssumedName(path)
+			empty := types.NewPackage(path, name)
+			empty.MarkComplete()
+			return empty, nil
+		}),
+	}
+
+	typed, _ := cfg.Check(ipkg.Meta.ImportPath, pkg2.FileSet, files, nil)
+	ctx.linux[ipkg] = typed
+	return typed, nil
+}
+
+// Generate the source of the file declaring the stubs of the package
+//
+// Functions that return an error return ENOSYS (or errors.ErrUnsupported if ENOSYS isn't available),
+// other functions panic and are reported in the Panics of the stubs
+func (handle *Handle) stubSource(stubs map[string]*stubDecl) ([]byte, fileStubs, error) {
+	// Import names are picked as the packages are used
+	imports := make(map[string]string)
+	taken := make(map[string]bool)
+	qualify := func(other *types.Package) string {
+		if name, ok := imports[other.Path()]; ok {
+			return name
+		}
+		name := other.Name()
+		for idx := 2; taken[name]; idx++ {
+			name = other.Name() + strconv.Itoa(idx)
+		}
+		imports[other.Path()], taken[name] = name, true
+		return name
+	}
+
+	names := make([]string, 0, len(stubs))
+	for name := range stubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body strings.Builder
+	var declared fileStubs
+	for _, name := range names {
+		stub := stubs[name]
+		symbol := stub.ipkg.Meta.ImportPath + "." + stub.symbol
+		declared.Symbols = append(declared.Symbols, base.SymbolRepl{Original: symbol, New: name})
+		fmt.Fprintf(&body, "\n// Stub of %v, which is not defined on %v\n", symbol, base.GOOS())
+
+		switch obj := stub.obj.(type) {
+		case *types.Var:
+			fmt.Fprintf(&body, "var %v %v\n", name, types.TypeString(obj.Type(), qualify))
+
+		case *types.Func:
+			sig := obj.Type().(*types.Signature)
+
+			// Methods are called with the value they are called on as the first argument
+			var params []string
+			if sig.Recv() != nil {
+				params = append(params, "_ interface{}")
+			}
+			for idx := 0; idx < sig.Params().Len(); idx++ {
+				typ := sig.Params().At(idx).Type()
+				if sig.Variadic() && idx == sig.Params().Len()-1 {
+					params = append(params, "_ ..."+types.TypeString(typ.(*types.Slice).Elem(), qualify))
+				} else {
+					params = append(params, "_ "+types.TypeString(typ, qualify))
+				}
+			}
+
+			var results, values []string
+			for idx := 0; idx < sig.Results().Len(); idx++ {
+				typ := sig.Results().At(idx).Type()
+				results = append(results, types.TypeString(typ, qualify))
+				values = append(values, zeroValue(typ, qualify))
+			}
+
+			fmt.Fprintf(&body, "func %v(%v)", name, strings.Join(params, ", "))
+			if len(results) == 1 {
+				fmt.Fprintf(&body, " %v", results[0])
+			} else if len(results) > 1 {
+				fmt.Fprintf(&body, " (%v)", strings.Join(results, ", "))
+			}
+
+			last := sig.Results().Len() - 1
+			errPkg, errName := handle.stubError(stub.ipkg)
+			if last >= 0 && errPkg != nil && types.Identical(sig.Results().At(last).Type(), types.Universe.Lookup("error").Type()) {
+				values[last] = qualify(errPkg) + "." + errName
+				fmt.Fprintf(&body, " {\n\treturn %v\n}\n", strings.Join(values, ", "))
+			} else {
+				fmt.Fprintf(&body, " {\n\tpanic(%q)\n}\n", fmt.Sprintf("%v is not supported on %v", symbol, base.GOOS()))
+				declared.Panics = append(declared.Panics, symbol)
+			}
+		}
+	}
+
+	// Type strings write unsafe.Pointer without asking for the name of the package
+	if strings.Contains(body.String(), "unsafe.Pointer") {
+		qualify(types.Unsafe)
+	}
+
+	paths := make([]string, 0, len(imports))
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var src strings.Builder
+	fmt.Fprintf(&src, "package %v\n", handle.pkg.Meta.Name)
+	if len(paths) > 0 {
+		src.WriteString("\nimport (\n")
+		for _, path := range paths {
+			if name, _ := pkg2.ImportPathToAssumedName(path); name == imports[path] {
+				fmt.Fprintf(&src, "\t%q\n", path)
+			} else {
+				fmt.Fprintf(&src, "\t%v %q\n", imports[path], path)
+			}
+		}
+		src.WriteString(")\n")
+	}
+	src.WriteString(body.String())
+
+	out, err := format.Source([]byte(src.String()))
+	if err != nil {
+		return nil, fileStubs{}, fmt.Errorf("unable to format stubs: %w", err)
+	}
+	return out, declared, nil
+}
+
+// Error value returned by the stubs of a package, nil if none is available
+//
+// The package the definitions are missing from usually declares ENOSYS (eg. syscall and golang.org/x/sys/unix)
+func (handle *Handle) stubError(ipkg *pkg2.Package) (*types.Package, string) {
+	errType := types.Universe.Lookup("error").Type()
+	candidates := []struct {
+		typed *types.Package
+		name  string
+	}{
+		{handle.ctx.handles[ipkg].types, "ENOSYS"},
+		{handle.importedTypes("syscall"), "ENOSYS"},
+		{handle.importedTypes("errors"), "ErrUnsupported"},
+	}
+
+	for _, cand := range candidates {
+		if cand.typed == nil {
+			continue
+		}
+		if obj := cand.typed.Scope().Lookup(cand.name); obj != nil && obj.Exported() && types.AssignableTo(obj.Type(), errType) {
+			return cand.typed, cand.name
+		}
+	}
+	return nil, ""
+}
+
+// Zero value of a type as written in a return statement
+func zeroValue(typ types.Type, qualify types.Qualifier) string {
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case t.Info()&types.IsBoolean != 0:
+			return "false"
+		case t.Info()&types.IsString != 0:
+			return `""`
+		case t.Info()&types.IsNumeric != 0:
+			return "0"
+		}
+	case *types.Struct, *types.Array:
+		return types.TypeString(typ, qualify) + "{}"
+	}
+	return "nil"
+}
@@ -0,0 +1,156 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package port2
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/zosopentools/wharf/internal/pkg2"
+)
+
+const testStubLinuxSrc = `package unix
+
+type Errno uintptr
+
+func (e Errno) Error() string { return "errno" }
+
+const ENOSYS = Errno(38)
+
+const EPOLLIN = 0x1
+
+type Termios struct{ Iflag uint32 }
+
+func (t *Termios) Flush(queue int) error { return nil }
+
+type Utsname struct{ Sysname [65]byte }
+
+var Stdin = 0
+
+func EpollCreate(size int) (fd int, err error) { return 0, nil }
+
+func Ioctl(fd int, req uint, args ...uintptr) error { return nil }
+
+func Gettid() int { return 0 }
+
+func Attrs(t *Termios) (string, bool, Termios, error) { return "", false, Termios{}, nil }
+
+func Uname(buf *Utsname) error { return nil }
+`
+
+// The platform version of the package, missing most definitions
+const testStubPlatformSrc = `package unix
+
+type Errno uintptr
+
+func (e Errno) Error() string { return "errno" }
+
+const ENOSYS = Errno(109)
+
+type Termios struct{ Iflag uint32 }
+`
+
+func checkTestPackage(t *testing.T, path string, src string, imp types.Importer) *types.Package {
+	t.Helper()
+	file, err := parser.ParseFile(pkg2.FileSet, path+"/src.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed, err := (&types.Config{Importer: imp}).Check(path, pkg2.FileSet, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatalf("%v: %v\n%v", path, err, src)
+	}
+	return typed
+}
+
+// A package importing example.com/unix, with the linux and platform versions of unix type checked from source
+func newStubHandle(t *testing.T) (*Handle, *pkg2.Package, *types.Package) {
+	linux := checkTestPackage(t, "example.com/unix", testStubLinuxSrc, nil)
+	platform := checkTestPackage(t, "example.com/unix", testStubPlatformSrc, nil)
+
+	ipkg := &pkg2.Package{Meta: &pkg2.MetaPackage{ImportPath: "example.com/unix", Name: "unix"}}
+	pkg := &pkg2.Package{
+		Meta:    &pkg2.MetaPackage{ImportPath: "example.com/app", Name: "app"},
+		Imports: map[string]*pkg2.Package{"example.com/unix": ipkg},
+	}
+
+	ctx := NewContext()
+	ctx.linux[ipkg] = linux
+	ctx.GetHandle(ipkg).types = platform
+	return ctx.GetHandle(pkg), ipkg, platform
+}
+
+func TestStubSource(t *testing.T) {
+	handle, ipkg, platform := newStubHandle(t)
+
+	termios := "Termios"
+	names := []pkg2.TCBadName{
+		{Name: "EpollCreate"},
+		{Name: "Ioctl"},
+		{Name: "Gettid"},
+		{Name: "Attrs"},
+		{Name: "Stdin"},
+		{MemberOf: &termios, Name: "Flush"},
+	}
+	stubs := make(map[string]*stubDecl)
+	for _, name := range names {
+		stub, err := handle.stubFor(ipkg, name)
+		if err != nil {
+			t.Fatalf("%v: %v", name.Name, err)
+		}
+		stubs[stubName(ipkg, stub.symbol)] = stub
+	}
+
+	src, declared, err := handle.stubSource(stubs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stubs must type check against the platform version of the package
+	checkTestPackage(t, "example.com/app", string(src), mapImporter{"example.com/unix": platform})
+
+	expected := []string{
+		"func wharf_unix_EpollCreate(_ int) (int, error) {\n\treturn 0, unix.ENOSYS\n}",
+		"func wharf_unix_Ioctl(_ int, _ uint, _ ...uintptr) error {\n\treturn unix.ENOSYS\n}",
+		"func wharf_unix_Attrs(_ *unix.Termios) (string, bool, unix.Termios, error) {\n\treturn \"\", false, unix.Termios{}, unix.ENOSYS\n}",
+		"func wharf_unix_Termios_Flush(_ interface{}, _ int) error {\n\treturn unix.ENOSYS\n}",
+		"func wharf_unix_Gettid() int {\n\tpanic(",
+		"var wharf_unix_Stdin int\n",
+	}
+	for _, decl := range expected {
+		if !strings.Contains(string(src), decl) {
+			t.Errorf("expected stubs to declare:\n%v\ngot:\n%s", decl, src)
+		}
+	}
+
+	if len(declared.Symbols) != len(names) {
+		t.Errorf("expected %v symbols, got %v", len(names), declared.Symbols)
+	}
+	if len(declared.Panics) != 1 || declared.Panics[0] != "example.com/unix.Gettid" {
+		t.Errorf("expected only the stub of Gettid to panic, got %v", declared.Panics)
+	}
+}
+
+func TestStubForRejects(t *testing.T) {
+	handle, ipkg, _ := newStubHandle(t)
+
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		// The linux value of a constant means something else on other platforms
+		{"EPOLLIN", "constants can't be stubbed"},
+		{"Uname", "uses unix.Utsname, which is not defined on"},
+		{"Missing", "not defined on linux"},
+	}
+	for _, tc := range cases {
+		_, err := handle.stubFor(ipkg, pkg2.TCBadName{Name: tc.name})
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%v: expected error %q, got %v", tc.name, tc.expected, err)
+		}
+	}
+}
@@ -14,9 +14,14 @@ import (
 	"strings"
 )
 
+// The unix-like platforms to borrow build configs from, listed in order of build priority
+//
+// Excludes the target platform and the platforms it implies (see SetTarget)
+var UNIX_PLATFORM_RANKING = append([]string(nil), platformRanking...)
+
 // All the unix-like platforms, listed in order of build priority
 // Must match 'unixOS' list below
-var UNIX_PLATFORM_RANKING = []string{
+var platformRanking = []string{
 	"linux",
 	"openbsd",
 	"freebsd",
@@ -31,6 +36,15 @@ var UNIX_PLATFORM_RANKING = []string{
 	"aix",
 }
 
+// Platforms that also satisfy the tag of another platform
+//
+// The contents of this are based on $GOROOT/src/go/build/build.go
+var impliedOS = map[string]string{
+	"android": "linux",
+	"illumos": "solaris",
+	"ios":     "darwin",
+}
+
 var knownOS = map[string]bool{
 	"aix":       true,
 	"android":   true,
@@ -97,6 +111,26 @@ var knownArch = map[string]bool{
 	"wasm":        true,
 }
 
+// Set the platform packages are ported to
+//
+// The target and the platform it implies are removed from UNIX_PLATFORM_RANKING,
+// as files built for them are already built for the target
+func SetTarget(goos string) error {
+	if !unixOS[goos] {
+		return fmt.Errorf("%v is not a unix-like platform", goos)
+	}
+
+	ranking := make([]string, 0, len(platformRanking))
+	for _, pltf := range platformRanking {
+		if pltf != goos && pltf != impliedOS[goos] {
+			ranking = append(ranking, pltf)
+		}
+	}
+	UNIX_PLATFORM_RANKING = ranking
+
+	return nil
+}
+
 type Constraint interface{}
 
 type Ignored struct{}
@@ -107,8 +141,8 @@ type Supported struct{}
 
 type All struct{}
 
-func Parse(name string, src []byte, goos string, buildtags map[string]bool) Constraint {
-	nametag, ok := ParseFileName(name)
+func Parse(name string, src []byte, goos string, goarch string, buildtags map[string]bool) Constraint {
+	nametag, ok := ParseFileName(name, goarch)
 	if !ok {
 		return Ignored{}
 	}
@@ -133,6 +167,7 @@ func Parse(name string, src []byte, goos string, buildtags map[string]bool) Cons
 			expr,
 			false,
 			&goos,
+			goarch,
 			buildtags,
 		)
 
@@ -147,8 +182,11 @@ func Parse(name string, src []byte, goos string, buildtags map[string]bool) Cons
 	}
 }
 
-func ParseFileName(name string) (nametag *constraint.TagExpr, ok bool) {
-	name = strings.TrimSuffix(name, ".go")
+// Parse the GOOS and GOARCH constraints of a file name (of any source file, eg. .go or .s)
+//
+// Returns ok as false if the file is for a different GOARCH or a non unix-like GOOS
+func ParseFileName(name string, goarch string) (nametag *constraint.TagExpr, ok bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
 
 	// Files named name_test.go can show up as IgnoredFiles and not Test files
 	if strings.HasSuffix(name, "_test") {
@@ -161,8 +199,7 @@ func ParseFileName(name string) (nametag *constraint.TagExpr, ok bool) {
 	if idx > 0 && idx < len(name)-1 {
 		tag := name[idx+1:]
 		if knownArch[tag] {
-			// TODO: This should not be hardcoded in
-			if tag != "s390x" {
+			if tag != goarch {
 				// Files that are for a different GOARCH are a DO NOT USE
 				return
 			}
@@ -190,6 +227,19 @@ func ParseFileName(name string) (nametag *constraint.TagExpr, ok bool) {
 	return
 }
 
+// Name for a copy of a file that is built for the given GOOS
+//
+// The GOOS goes before a GOARCH suffix (eg. foo_linux_s390x.go => foo_linux_zos_s390x.go)
+// so that the copy keeps the GOARCH constraint of the original
+func TargetFileName(name string, goos string) string {
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext)
+	if idx := strings.LastIndexByte(name, byte('_')); idx > 0 && knownArch[name[idx+1:]] {
+		return name[:idx] + "_" + goos + name[idx:] + ext
+	}
+	return name + "_" + goos + ext
+}
+
 // This algorithm determines what platforms a file will build under
 //
 // Specifically it will report back the unix-like platforms (GOOS values)
@@ -200,10 +250,10 @@ func ParseFileName(name string) (nametag *constraint.TagExpr, ok bool) {
 // however for situations where a GOOS tag exists, it is obvious that this file is meant for GOOS
 //
 // To build this list we have the following rules:
-// 1. Treat the tag GOARCH as 'unix'
-// 2. Expand the tag 'unix' to the full set of unixOS tags
+// 1. Expand the tag 'unix' to the full set of unixOS tags
 // 2. Only report back tags that fall under the 'unix' definition (as defined in syslist.go)
-// 3. Treat all other tags (including non-unix GOOS tags, GOARCH tags, and build tags) as FALSE
+// 3. Treat the tag for the target GOARCH as TRUE and all other GOARCH tags as FALSE
+// 4. Treat all other tags (including non-unix GOOS tags and unset build tags) as FALSE
 
 // Set representation of platform constraints
 //
@@ -216,7 +266,7 @@ func ParseFileName(name string) (nametag *constraint.TagExpr, ok bool) {
 // Ex: (linux || darwin) && !aix && !freebsd && ...
 
 // Parses the tag expression into a constraint
-func parseTagExpr(expr constraint.Expr, negate bool, goos *string, atags map[string]bool) Constraint {
+func parseTagExpr(expr constraint.Expr, negate bool, goos *string, goarch string, atags map[string]bool) Constraint {
 	switch expr2 := expr.(type) {
 	case *constraint.OrExpr:
 		// x || y
@@ -224,15 +274,15 @@ func parseTagExpr(expr constraint.Expr, negate bool, goos *string, atags map[str
 		if negate {
 			// !(x || y) == !x && !y
 			return handleAndExpr(
-				parseTagExpr(expr2.X, negate, goos, atags),
-				parseTagExpr(expr2.Y, negate, goos, atags),
+				parseTagExpr(expr2.X, negate, goos, goarch, atags),
+				parseTagExpr(expr2.Y, negate, goos, goarch, atags),
 				*goos,
 			)
 		}
 
 		return handleOrExpr(
-			parseTagExpr(expr2.X, negate, goos, atags),
-			parseTagExpr(expr2.Y, negate, goos, atags),
+			parseTagExpr(expr2.X, negate, goos, goarch, atags),
+			parseTagExpr(expr2.Y, negate, goos, goarch, atags),
 		)
 
 	case *constraint.AndExpr:
@@ -241,35 +291,35 @@ func parseTagExpr(expr constraint.Expr, negate bool, goos *string, atags map[str
 		if negate {
 			// !(x && y) == !x || !y
 			return handleOrExpr(
-				parseTagExpr(expr2.X, negate, goos, atags),
-				parseTagExpr(expr2.Y, negate, goos, atags),
+				parseTagExpr(expr2.X, negate, goos, goarch, atags),
+				parseTagExpr(expr2.Y, negate, goos, goarch, atags),
 			)
 		}
 
 		return handleAndExpr(
-			parseTagExpr(expr2.X, negate, goos, atags),
-			parseTagExpr(expr2.Y, negate, goos, atags),
+			parseTagExpr(expr2.X, negate, goos, goarch, atags),
+			parseTagExpr(expr2.Y, negate, goos, goarch, atags),
 			*goos,
 		)
 
 	case *constraint.NotExpr:
 		// !x
-		return parseTagExpr(expr2.X, !negate, goos, atags)
+		return parseTagExpr(expr2.X, !negate, goos, goarch, atags)
 
 	case *constraint.TagExpr:
 		// x
-		return handleTagExpr(expr2.Tag, negate, *goos, atags)
+		return handleTagExpr(expr2.Tag, negate, *goos, goarch, atags)
 
 	default:
 		panic(fmt.Errorf("golang: unknown tag expression type: %T", expr2))
 	}
 }
 
-func handleTagExpr(tag string, negate bool, goos string, atags map[string]bool) Constraint {
+func handleTagExpr(tag string, negate bool, goos string, goarch string, atags map[string]bool) Constraint {
 	// Return a set for any unix OS tags
 	if unixOS[tag] {
-		// The GOOS flag either signifies a "never" or a "GOOS" specifically (treat it as a never if negated)
-		if tag == goos {
+		// The GOOS flag (or a flag it implies) either signifies a "never" or a "GOOS" specifically (treat it as a never if negated)
+		if tag == goos || tag == impliedOS[goos] {
 			if negate {
 				return Ignored{}
 			}
@@ -295,6 +345,14 @@ func handleTagExpr(tag string, negate bool, goos string, atags map[string]bool)
 		return cstr
 	}
 
+	// Architecture tags are only set for the target GOARCH, on every platform
+	if knownArch[tag] {
+		if (tag == goarch) != negate {
+			return All{}
+		}
+		return Ignored{}
+	}
+
 	// Fallback logic is reversed for 'unix' and provided build tags
 	if tag == "unix" || atags[tag] {
 		negate = !negate
@@ -455,3 +455,121 @@ func TestWhenOrX(t *testing.T) {
 	}
 
 }
+
+// // // // // // //
+// TARGET CASES   //
+// // // // // // //
+
+func TestImpliedTag(t *testing.T) {
+	var result Constraint
+
+	// solaris IS Goos WHEN targeting illumos
+	result = handleTagExpr("solaris", false, "illumos", "amd64", nil)
+	if _, ok := result.(Supported); !ok {
+		t.Errorf("solaris (illumos) IS NOT %[1]T (%[1]v)", result)
+		return
+	}
+
+	// !solaris IS Never WHEN targeting illumos
+	result = handleTagExpr("solaris", true, "illumos", "amd64", nil)
+	if _, ok := result.(Ignored); !ok {
+		t.Errorf("!solaris (illumos) IS NOT %[1]T (%[1]v)", result)
+		return
+	}
+
+	// illumos IS When WHEN targeting solaris
+	result = handleTagExpr("illumos", false, "solaris", "amd64", nil)
+	if rWhen, ok := result.(Platforms); !ok || !rWhen["illumos"] || len(rWhen) != 1 {
+		t.Errorf("illumos (solaris) IS NOT When (%v)", result)
+		return
+	}
+}
+
+func TestSetTarget(t *testing.T) {
+	defer SetTarget("zos")
+
+	if err := SetTarget("windows"); err == nil {
+		t.Errorf("windows accepted as a unix-like target")
+		return
+	}
+
+	if err := SetTarget("illumos"); err != nil {
+		t.Errorf("illumos not accepted as a target: %v", err)
+		return
+	}
+	for _, pltf := range UNIX_PLATFORM_RANKING {
+		if pltf == "illumos" || pltf == "solaris" {
+			t.Errorf("%v still ranked when targeting illumos: %v", pltf, UNIX_PLATFORM_RANKING)
+			return
+		}
+	}
+	if len(UNIX_PLATFORM_RANKING) != len(platformRanking)-2 {
+		t.Errorf("unexpected ranking when targeting illumos: %v", UNIX_PLATFORM_RANKING)
+		return
+	}
+}
+
+// // // // // // //
+// ARCH CASES     //
+// // // // // // //
+
+func TestFileNameArch(t *testing.T) {
+	cases := []struct {
+		name string
+		tag  string
+		ok   bool
+	}{
+		{"foo_linux_s390x.go", "linux", true},
+		{"foo_linux_amd64.go", "", false},
+		{"foo_s390x.go", "", true},
+		{"foo_amd64.s", "", false},
+		{"foo_linux_s390x.s", "linux", true},
+		{"foo_windows_s390x.go", "", false},
+		{"foo.go", "", true},
+	}
+
+	for _, c := range cases {
+		nametag, ok := ParseFileName(c.name, "s390x")
+		tag := ""
+		if nametag != nil {
+			tag = nametag.Tag
+		}
+		if ok != c.ok || tag != c.tag {
+			t.Errorf("%v (s390x): got (%q, %v), expected (%q, %v)", c.name, tag, ok, c.tag, c.ok)
+		}
+	}
+}
+
+func TestExprArch(t *testing.T) {
+	src := []byte("//go:build linux && (s390x || ppc64)\n\npackage foo\n")
+
+	result := Parse("foo.go", src, "zos", "s390x", nil)
+	if rWhen, ok := result.(Platforms); !ok || !rWhen["linux"] || len(rWhen) != 1 {
+		t.Errorf("linux && (s390x || ppc64) (zos/s390x) IS NOT When (%v)", result)
+	}
+
+	result = Parse("foo.go", src, "zos", "amd64", nil)
+	if _, ok := result.(Ignored); !ok {
+		t.Errorf("linux && (s390x || ppc64) (zos/amd64) IS NOT %[1]T (%[1]v)", result)
+	}
+
+	result = Parse("foo.go", []byte("//go:build !s390x\n\npackage foo\n"), "zos", "s390x", nil)
+	if _, ok := result.(Ignored); !ok {
+		t.Errorf("!s390x (zos/s390x) IS NOT %[1]T (%[1]v)", result)
+	}
+}
+
+func TestTargetFileName(t *testing.T) {
+	cases := map[string]string{
+		"foo_linux.go":       "foo_linux_zos.go",
+		"foo_linux_s390x.go": "foo_linux_zos_s390x.go",
+		"foo_s390x.s":        "foo_zos_s390x.s",
+		"foo.go":             "foo_zos.go",
+	}
+
+	for name, expected := range cases {
+		if result := TargetFileName(name, "zos"); result != expected {
+			t.Errorf("%v: got %v, expected %v", name, result, expected)
+		}
+	}
+}
@@ -8,19 +8,35 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
 )
 
 /////////////////////
 // SCRIPT COMMANDS //
 /////////////////////
 
-// Run the patch command
+// Run the patch command, writing the patched target to output
+//
+// An empty target patches an empty file (used by diffs that create a file)
 func Patch(target string, output string, diff []byte) error {
-	cmd := exec.Command("patch", target, "-o", output)
-	cmd.Stdin = &bytes.Buffer{}
-	cmd.Stdin.Read(diff)
+	if target == "" {
+		empty, err := os.CreateTemp("", "wharf-patch-")
+		if err != nil {
+			return err
+		}
+		empty.Close()
+		defer os.Remove(empty.Name())
+		target = empty.Name()
+	}
+
+	cmd := exec.Command("patch", "-N", "-o", output, target)
+	cmd.Stdin = bytes.NewReader(diff)
 	return run(cmd)
 }
 
@@ -65,6 +81,27 @@ func GoTest(paths []string) (string, error) {
 	return runout(cmd)
 }
 
+// A GOOS/GOARCH pair supported by the Go toolchain
+type Port struct {
+	GOOS   string
+	GOARCH string
+}
+
+// Run go tool dist list and return the platforms the Go toolchain can build for
+func GoToolDistList() ([]Port, error) {
+	cmd := exec.Command("go", "tool", "dist", "list", "-json")
+	out, err := runout(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []Port
+	if err := json.Unmarshal([]byte(out), &ports); err != nil {
+		return nil, err
+	}
+	return ports, nil
+}
+
 ////////////////////////
 // WORKSPACE COMMANDS //
 ////////////////////////
@@ -82,6 +119,20 @@ func GoWorkEditReplaceVersion(path string, version string) error {
 	return run(cmd)
 }
 
+// Replace entry in go.mod with another module (eg. a fork)
+func GoWorkEditReplace(path string, newPath string, version string) error {
+	cmd := exec.Command("go", "work", "edit", "-replace",
+		path+"="+newPath+"@"+version,
+	)
+	return run(cmd)
+}
+
+// Replace entry in go.mod with a folder
+func GoWorkEditReplaceDir(path string, dir string) error {
+	cmd := exec.Command("go", "work", "edit", "-replace", path+"="+dir)
+	return run(cmd)
+}
+
 // Drop replace entry in go.mod
 func GoWorkEditDropReplace(path string) error {
 	cmd := exec.Command("go", "work", "edit", "-dropreplace", path)
@@ -111,12 +162,151 @@ func GoListModUpdate(mod string) (string, error) {
 	return runout(cmd)
 }
 
+// Run go list -m -versions and return the released versions of the module known to GOPROXY, in increasing order
+//
+// Falls back to the versions in the module cache if GOPROXY can't be reached (eg. GOPROXY=off)
+func GoListModVersions(mod string) ([]string, error) {
+	cmd := exec.Command("go", "list", "-json", "-m", "-versions", "-mod=readonly", mod)
+	out, err := runout(cmd)
+	if err == nil {
+		var info struct {
+			Versions []string
+		}
+		if err := json.Unmarshal([]byte(out), &info); err != nil {
+			return nil, err
+		}
+		return sortVersions(info.Versions), nil
+	}
+
+	versions, cacheErr := cachedModVersions(mod)
+	if cacheErr != nil || len(versions) == 0 {
+		return nil, fmt.Errorf("%v\n %w", out, err)
+	}
+	return versions, nil
+}
+
+// Versions of a module downloaded to the module cache, in increasing order
+func cachedModVersions(mod string) ([]string, error) {
+	env, err := GoEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Upper case letters are escaped in the paths of the module cache
+	var escaped strings.Builder
+	for _, r := range mod {
+		if 'A' <= r && r <= 'Z' {
+			escaped.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		escaped.WriteRune(r)
+	}
+
+	zips, err := filepath.Glob(filepath.Join(env["GOMODCACHE"], "cache", "download", filepath.FromSlash(escaped.String()), "@v", "*.zip"))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, zip := range zips {
+		versions = append(versions, strings.TrimSuffix(filepath.Base(zip), ".zip"))
+	}
+	return sortVersions(versions), nil
+}
+
+// Sort valid semantic versions in increasing order, dropping the invalid ones
+func sortVersions(versions []string) []string {
+	sorted := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if semver.IsValid(v) {
+			sorted = append(sorted, v)
+		}
+	}
+	semver.Sort(sorted)
+	return sorted
+}
+
+// Run go list -m and return the version of the module
+func GoListModVersion(mod string) (string, error) {
+	cmd := exec.Command("go", "list", "-f", "{{.Version}}", "-m", "-mod=readonly", mod)
+	return runout(cmd)
+}
+
 // Run go list -m and return the directory of the active version
 func GoListModDir(mod string) (string, error) {
 	cmd := exec.Command("go", "list", "-f", "{{if .Replace}}{{.Replace.Dir}}{{else}}{{.Dir}}{{end}}", "-m", "-mod=readonly", mod)
 	return runout(cmd)
 }
 
+// Run go mod download and return the directory of the module in the module cache
+func GoModDownloadDir(mod string, version string) (string, error) {
+	cmd := exec.Command("go", "mod", "download", "-json", mod+"@"+version)
+	out, err := runout(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	var info struct {
+		Dir   string
+		Error string
+	}
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		return "", err
+	}
+	if info.Error != "" {
+		return "", fmt.Errorf("%v@%v: %v", mod, version, info.Error)
+	}
+
+	return info.Dir, nil
+}
+
+// A module listed by go list -m
+type ModuleInfo struct {
+	Path    string
+	Version string
+	Dir     string
+}
+
+// Run go list -m and return the main modules of the workspace
+func GoListMainModules() ([]ModuleInfo, error) {
+	cmd := exec.Command("go", "list", "-m", "-json", "-mod=readonly")
+	out, err := runout(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%v\n %w", out, err)
+	}
+
+	var mods []ModuleInfo
+	dec := json.NewDecoder(strings.NewReader(out))
+	for dec.More() {
+		var mod ModuleInfo
+		if err := dec.Decode(&mod); err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+// Run go list -m all and return every module in the build list of the workspace
+func GoListModules() ([]ModuleInfo, error) {
+	cmd := exec.Command("go", "list", "-m", "-json", "-mod=readonly", "all")
+	out, err := runout(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%v\n %w", out, err)
+	}
+
+	var mods []ModuleInfo
+	dec := json.NewDecoder(strings.NewReader(out))
+	for dec.More() {
+		var mod ModuleInfo
+		if err := dec.Decode(&mod); err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
 // Run go list
 func GoList(pkgs []string) (string, error) {
 	cmd := exec.Command("go", append([]string{"list", "-json", "-e", "-deps", "-mod=readonly"}, pkgs...)...)
@@ -151,8 +341,15 @@ func runout(cmd *exec.Cmd) (string, error) {
 	var stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	start := time.Now()
 	err := cmd.Run()
 
+	if err != nil {
+		LogAction(ACT_EXEC, "%v (%v, failed: %v)", strings.Join(cmd.Args, " "), time.Since(start).Round(time.Millisecond), err)
+	} else {
+		LogAction(ACT_EXEC, "%v (%v)", strings.Join(cmd.Args, " "), time.Since(start).Round(time.Millisecond))
+	}
+
 	if err == nil {
 		return strings.TrimSpace(stdout.String()), nil
 	} else {
@@ -0,0 +1,456 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+// This package is dedicated to producing diffs between file contents
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Lines of context kept around each change in a unified diff
+const diffContext = 3
+
+type diffOp uint8
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// Create a unified diff between two versions of a file
+//
+// Use "/dev/null" as a name to mark a created or deleted file.
+// Returns nil if the contents are identical
+func UnifiedDiff(oldName, newName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+
+	script := diffLines(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %v\n+++ %v\n", oldName, newName)
+
+	// Group changes that are close together into hunks
+	idx := 0
+	for idx < len(script) {
+		// Find the next change
+		for idx < len(script) && script[idx].op == diffEqual {
+			idx++
+		}
+		if idx >= len(script) {
+			break
+		}
+
+		start := idx - diffContext
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk until a run of unchanged lines is long enough to split on
+		end := idx
+		for end < len(script) {
+			if script[end].op != diffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].op == diffEqual {
+				run++
+			}
+			if run >= len(script) || run-end > 2*diffContext {
+				end += diffContext
+				if end > run {
+					end = run
+				}
+				break
+			}
+			end = run
+		}
+
+		writeHunk(&out, script, start, end)
+		idx = end
+	}
+
+	return out.Bytes()
+}
+
+func writeHunk(out *bytes.Buffer, script []diffLine, start, end int) {
+	// Line numbers where the hunk starts in each file
+	aLine, bLine := 1, 1
+	for _, line := range script[:start] {
+		if line.op != diffInsert {
+			aLine++
+		}
+		if line.op != diffDelete {
+			bLine++
+		}
+	}
+
+	aCount, bCount := 0, 0
+	for _, line := range script[start:end] {
+		if line.op != diffInsert {
+			aCount++
+		}
+		if line.op != diffDelete {
+			bCount++
+		}
+	}
+
+	// Empty ranges are reported as starting on the line before
+	if aCount == 0 {
+		aLine--
+	}
+	if bCount == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(out, "@@ -%v +%v @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+	for _, line := range script[start:end] {
+		switch line.op {
+		case diffEqual:
+			out.WriteByte(' ')
+		case diffDelete:
+			out.WriteByte('-')
+		case diffInsert:
+			out.WriteByte('+')
+		}
+		out.WriteString(line.text)
+		if len(line.text) == 0 || line.text[len(line.text)-1] != '\n' {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(line, count int) string {
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%v,%v", line, count)
+}
+
+// Split content into lines, keeping the line endings
+func splitLines(content []byte) []string {
+	lines := make([]string, 0, bytes.Count(content, []byte("\n"))+1)
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		lines = append(lines, string(content[:end]))
+		content = content[end:]
+	}
+	return lines
+}
+
+// Compute the shortest edit script between two lists of lines (Myers' algorithm)
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+
+	// Created and deleted files need no search
+	if n == 0 || m == 0 {
+		script := make([]diffLine, 0, n+m)
+		for _, line := range a {
+			script = append(script, diffLine{diffDelete, line})
+		}
+		for _, line := range b {
+			script = append(script, diffLine{diffInsert, line})
+		}
+		return script
+	}
+
+	max := n + m
+	offset := max + 1
+
+	// Keep the furthest reaching paths of each edit distance to backtrack on, only the
+	// diagonals -d..d can be reached with d edits so trace[d] holds v[offset-d:offset+d+1]
+	v := make([]int, 2*max+2)
+	trace := make([][]int, 0, 16)
+
+	var dist int
+search:
+	for dist = 0; dist <= max; dist++ {
+		for k := -dist; k <= dist; k += 2 {
+			var x int
+			if k == -dist || (k != dist && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-dist:offset+dist+1]...))
+				break search
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-dist:offset+dist+1]...))
+	}
+
+	// Walk back through the trace to build the script
+	script := make([]diffLine, 0, n+m)
+	x, y := n, m
+	for d := dist; d > 0; d-- {
+		// Diagonal k of the previous step is at prev[k+d-1]
+		prev := trace[d-1]
+		k := x - y
+
+		var pk int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := prev[pk+d-1]
+		py := px - pk
+
+		for x > px && y > py {
+			x--
+			y--
+			script = append(script, diffLine{diffEqual, a[x]})
+		}
+		if x == px {
+			y--
+			script = append(script, diffLine{diffInsert, b[y]})
+		} else {
+			x--
+			script = append(script, diffLine{diffDelete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		script = append(script, diffLine{diffEqual, a[x]})
+	}
+
+	// The script was built backwards
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
+
+// A change to a file to include in a patch
+type FileDiff struct {
+	// Path of the file relative to the root of the repository
+	Name string
+
+	// Contents of the file before and after the change (Old is nil for created files)
+	Old []byte
+	New []byte
+}
+
+// Create a patch in the style of 'git format-patch' from a list of file changes
+func FormatPatch(author string, subject string, date time.Time, files []FileDiff) []byte {
+	var stat, body bytes.Buffer
+	insertions, deletions := 0, 0
+	width := 0
+	for _, file := range files {
+		if len(file.Name) > width {
+			width = len(file.Name)
+		}
+	}
+
+	var created []string
+	changed := 0
+	for _, file := range files {
+		var diff []byte
+		if file.Old == nil {
+			diff = UnifiedDiff("/dev/null", "b/"+file.Name, nil, file.New)
+		} else {
+			diff = UnifiedDiff("a/"+file.Name, "b/"+file.Name, file.Old, file.New)
+		}
+		if diff == nil {
+			continue
+		}
+		changed++
+		if file.Old == nil {
+			created = append(created, file.Name)
+		}
+
+		added, removed := 0, 0
+		for _, line := range bytes.Split(diff, []byte("\n")) {
+			if bytes.HasPrefix(line, []byte("+")) && !bytes.HasPrefix(line, []byte("+++ ")) {
+				added++
+			} else if bytes.HasPrefix(line, []byte("-")) && !bytes.HasPrefix(line, []byte("--- ")) {
+				removed++
+			}
+		}
+		insertions += added
+		deletions += removed
+		fmt.Fprintf(&stat, " %-*v | %v %v%v\n", width, file.Name, added+removed,
+			strings.Repeat("+", added), strings.Repeat("-", removed))
+
+		fmt.Fprintf(&body, "diff --git a/%v b/%v\n", file.Name, file.Name)
+		if file.Old == nil {
+			fmt.Fprintf(&body, "new file mode 100644\nindex 0000000..%v\n", blobHash(file.New))
+		} else {
+			fmt.Fprintf(&body, "index %v..%v 100644\n", blobHash(file.Old), blobHash(file.New))
+		}
+		body.Write(diff)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001\n")
+	fmt.Fprintf(&out, "From: %v\n", author)
+	fmt.Fprintf(&out, "Date: %v\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&out, "Subject: [PATCH] %v\n\n---\n", subject)
+	out.Write(stat.Bytes())
+	fmt.Fprintf(&out, " %v file(s) changed, %v insertions(+), %v deletions(-)\n", changed, insertions, deletions)
+	for _, name := range created {
+		fmt.Fprintf(&out, " create mode 100644 %v\n", name)
+	}
+	out.WriteString("\n")
+	out.Write(body.Bytes())
+	out.WriteString("-- \nwharf\n")
+
+	return out.Bytes()
+}
+
+// Abbreviated hash git uses to identify the contents of a file
+func blobHash(content []byte) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %v\x00", len(content))
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))[:7]
+}
+
+// The changes a diff makes to one of its files
+type DiffFile struct {
+	// Path of the file, without the a/ and b/ prefixes
+	Name string
+
+	Created bool
+	Deleted bool
+
+	// Part of the diff for the file, including its headers
+	Section []byte
+}
+
+// Subject of a patch made by git format-patch, without the [PATCH] prefix
+func PatchSubject(diff []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "--- ") {
+			break
+		}
+		if subject := strings.TrimPrefix(line, "Subject: "); subject != line {
+			subject = strings.TrimSpace(subject)
+			if strings.HasPrefix(subject, "[") {
+				if end := strings.Index(subject, "] "); end >= 0 {
+					subject = subject[end+2:]
+				}
+			}
+			return subject
+		}
+	}
+	return ""
+}
+
+// Split a diff (possibly spanning several files, eg. the output of git format-patch) into the changes made to each file
+func SplitDiff(diff []byte) []DiffFile {
+	lines := bytes.SplitAfter(diff, []byte("\n"))
+
+	// Each file starts at its '---' line, or at the 'diff' line before the extended headers
+	var files []DiffFile
+	var starts []int
+	for idx := 0; idx+1 < len(lines); idx++ {
+		if !bytes.HasPrefix(lines[idx], []byte("--- ")) || !bytes.HasPrefix(lines[idx+1], []byte("+++ ")) {
+			continue
+		}
+
+		fstart := idx
+		for prev := idx - 1; prev >= 0 && !isHunkLine(lines[prev]); prev-- {
+			if bytes.HasPrefix(lines[prev], []byte("diff ")) {
+				fstart = prev
+				break
+			}
+		}
+
+		oldName, newName := diffFileName(lines[idx]), diffFileName(lines[idx+1])
+		file := DiffFile{Name: newName, Created: oldName == "/dev/null", Deleted: newName == "/dev/null"}
+		if file.Deleted {
+			file.Name = oldName
+		}
+		files = append(files, file)
+		starts = append(starts, fstart)
+		idx++
+	}
+
+	for idx := range files {
+		end := len(lines)
+		if idx+1 < len(files) {
+			end = starts[idx+1]
+		}
+		files[idx].Section = bytes.Join(lines[starts[idx]:end], nil)
+	}
+	return files
+}
+
+// Find the changes a diff (possibly spanning several files, eg. the output of git format-patch) makes to a file
+//
+// Unless exact is set, the file is also matched by the trailing elements of the paths in the diff, so a diff made
+// from the root of a repository applies to a file of a nested module. A file of the diff with the exact path is preferred.
+// Returns nil if no file of the diff matches, and an error if several do
+func DiffSection(diff []byte, file string, exact bool) (*DiffFile, error) {
+	var exacts, suffixes []DiffFile
+	for _, dfile := range SplitDiff(diff) {
+		if dfile.Name == file {
+			exacts = append(exacts, dfile)
+		} else if !exact && strings.HasSuffix(dfile.Name, "/"+file) {
+			suffixes = append(suffixes, dfile)
+		}
+	}
+
+	matches := exacts
+	if len(matches) == 0 {
+		matches = suffixes
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &matches[0], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, dfile := range matches {
+		names = append(names, dfile.Name)
+	}
+	return nil, fmt.Errorf("%v matches several files of the diff: %v", file, strings.Join(names, ", "))
+}
+
+// Lines of a hunk (or the summary of changed files git format-patch writes) never precede the headers of a file
+func isHunkLine(line []byte) bool {
+	return len(line) > 0 && bytes.IndexByte([]byte(" +-@\\\n"), line[0]) >= 0
+}
+
+// Name of a file from its '---' or '+++' line, without the a/ and b/ prefixes
+func diffFileName(line []byte) string {
+	name := strings.TrimRight(string(line[4:]), "\r\n")
+	if tab := strings.IndexByte(name, '\t'); tab >= 0 {
+		name = name[:tab]
+	}
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		name = name[2:]
+	}
+	return name
+}
@@ -0,0 +1,287 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package util
+
+import (
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFormatPatch = `From 7a071e33e693b65aa7518cb1b87ded64ab43fcce Mon Sep 17 00:00:00 2001
+Subject: [PATCH] Add zOS support
+
+---
+ sdk/blob/ioctl.go     |  2 +-
+ sdk/blob/ioctl_zos.go |  3 +++
+ 2 files changed, 4 insertions(+), 1 deletion(-)
+
+diff --git a/sdk/blob/ioctl.go b/sdk/blob/ioctl.go
+index 0000001..0000002 100644
+--- a/sdk/blob/ioctl.go
++++ b/sdk/blob/ioctl.go
+@@ -1,3 +1,3 @@
+ package blob
+ 
+-const x = 1
++const x = 2
+diff --git a/sdk/blob/ioctl_zos.go b/sdk/blob/ioctl_zos.go
+new file mode 100644
+index 0000000..0000003
+--- /dev/null
++++ b/sdk/blob/ioctl_zos.go
+@@ -0,0 +1,3 @@
++package blob
++
++const y = 1
+-- 
+2.42.1
+`
+
+func TestDiffSection(t *testing.T) {
+	cases := []struct {
+		file    string
+		created bool
+		first   string
+		last    string
+	}{
+		{"blob/ioctl.go", false, "diff --git a/sdk/blob/ioctl.go b/sdk/blob/ioctl.go\n", "+const x = 2\n"},
+		{"ioctl_zos.go", true, "diff --git a/sdk/blob/ioctl_zos.go b/sdk/blob/ioctl_zos.go\n", "2.42.1\n"},
+	}
+
+	for _, tc := range cases {
+		dfile, err := DiffSection([]byte(testFormatPatch), tc.file, false)
+		if err != nil || dfile == nil {
+			t.Errorf("%v: not found: %v", tc.file, err)
+			continue
+		}
+		lines := splitLines(dfile.Section)
+		if dfile.Created != tc.created || lines[0] != tc.first || lines[len(lines)-1] != tc.last {
+			t.Errorf("%v: unexpected section (created %v):\n%s", tc.file, dfile.Created, dfile.Section)
+		}
+	}
+
+	if dfile, _ := DiffSection([]byte(testFormatPatch), "zos.go", false); dfile != nil {
+		t.Errorf("matched a partial file name")
+	}
+	if dfile, _ := DiffSection([]byte(testFormatPatch), "ioctl.go", true); dfile != nil {
+		t.Errorf("matched the trailing elements of a path with exact set")
+	}
+
+	plain := "--- ioctl.go\t2023-01-01\n+++ ioctl.go\t2023-01-02\n@@ -1 +1 @@\n-a\n+b\n"
+	if dfile, err := DiffSection([]byte(plain), "ioctl.go", true); err != nil || dfile == nil || string(dfile.Section) != plain {
+		t.Errorf("unexpected section for plain diff: %+v, %v", dfile, err)
+	}
+
+	// Files of other packages with the same name make the match ambiguous, unless one has the exact path
+	twice := "--- a/a/errs.go\n+++ b/a/errs.go\n@@ -1 +1 @@\n-a\n+b\n" +
+		"--- a/b/errs.go\n+++ b/b/errs.go\n@@ -1 +1 @@\n-a\n+c\n"
+	root := "--- a/errs.go\n+++ b/errs.go\n@@ -1 +1 @@\n-a\n+d\n"
+	if _, err := DiffSection([]byte(twice), "c/x/errs.go", false); err != nil {
+		t.Errorf("unexpected error for a file the diff does not change: %v", err)
+	}
+	if dfile, err := DiffSection([]byte(twice+root), "errs.go", false); err != nil || dfile == nil || dfile.Name != "errs.go" {
+		t.Errorf("expected the exact match, got %+v, %v", dfile, err)
+	}
+	if _, err := DiffSection([]byte(twice), "errs.go", false); err == nil || !strings.Contains(err.Error(), "a/errs.go, b/errs.go") {
+		t.Errorf("expected an ambiguous match, got %v", err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	numbered := func(from, to int) string {
+		var lines strings.Builder
+		for idx := from; idx <= to; idx++ {
+			lines.WriteString(string(rune('a'+idx-1)) + "\n")
+		}
+		return lines.String()
+	}
+
+	cases := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			"one change",
+			numbered(1, 10),
+			strings.Replace(numbered(1, 10), "e\n", "E\n", 1),
+			"@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n",
+		},
+		{
+			"two hunks",
+			numbered(1, 16),
+			strings.Replace(strings.Replace(numbered(1, 16), "b\n", "", 1), "o\n", "o\nO\n", 1),
+			"@@ -1,5 +1,4 @@\n a\n-b\n c\n d\n e\n@@ -13,4 +12,5 @@\n m\n n\n o\n+O\n p\n",
+		},
+		{
+			"created",
+			"",
+			"a\nb\n",
+			"@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			"deleted",
+			"a\n",
+			"",
+			"@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			"no newline at end",
+			"a\nb",
+			"a\nc",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tc := range cases {
+		diff := UnifiedDiff("a/f", "b/f", []byte(tc.old), []byte(tc.new))
+		expected := "--- a/f\n+++ b/f\n" + tc.expected
+		if string(diff) != expected {
+			t.Errorf("%v: expected:\n%v\ngot:\n%s", tc.name, expected, diff)
+		}
+	}
+
+	if diff := UnifiedDiff("a/f", "b/f", []byte("a\n"), []byte("a\n")); diff != nil {
+		t.Errorf("expected no diff for identical contents, got:\n%s", diff)
+	}
+}
+
+// The edit script must turn a into b with as few edits as the longest common subsequence allows
+func TestDiffLines(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		out := make([]string, rnd.Intn(12))
+		for idx := range out {
+			out[idx] = string(rune('a' + rnd.Intn(4)))
+		}
+		return out
+	}
+
+	for run := 0; run < 500; run++ {
+		a, b := lines(), lines()
+		script := diffLines(a, b)
+
+		var gotA, gotB []string
+		edits := 0
+		for _, line := range script {
+			if line.op != diffInsert {
+				gotA = append(gotA, line.text)
+			}
+			if line.op != diffDelete {
+				gotB = append(gotB, line.text)
+			}
+			if line.op != diffEqual {
+				edits++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("%q -> %q: script does not reproduce the inputs: %v", a, b, script)
+		}
+
+		// Length of the longest common subsequence
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] > lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		if expected := len(a) + len(b) - 2*lcs[0][0]; edits != expected {
+			t.Fatalf("%q -> %q: expected %v edits, got %v", a, b, expected, edits)
+		}
+	}
+}
+
+// Diffing a large created file must not keep a copy of the search state for every line
+func TestUnifiedDiffCreatedMemory(t *testing.T) {
+	content := []byte(strings.Repeat("package blob // a line of a large generated file\n", 5000))
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	diff := UnifiedDiff("/dev/null", "b/big.go", nil, content)
+	runtime.ReadMemStats(&after)
+
+	if len(diff) == 0 {
+		t.Fatal("expected a diff")
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16<<20 {
+		t.Errorf("diffing a created file allocated %v MB", alloc>>20)
+	}
+}
+
+func TestBlobHash(t *testing.T) {
+	// git hash-object of an empty file and of "hello\n"
+	if hash := blobHash(nil); hash != "e69de29" {
+		t.Errorf("expected e69de29, got %v", hash)
+	}
+	if hash := blobHash([]byte("hello\n")); hash != "ce01362" {
+		t.Errorf("expected ce01362, got %v", hash)
+	}
+}
+
+func TestFormatPatchApplies(t *testing.T) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	files := []FileDiff{
+		{Name: "sdk/blob/ioctl.go", Old: []byte("package blob\n\nconst x = 1\n\nconst z = 3\n"), New: []byte("package blob\n\nconst x = 2\n\nconst z = 3\n")},
+		{Name: "sdk/blob/ioctl_zos.go", New: []byte("package blob\n\nconst y = 1\n")},
+		{Name: "sdk/blob/same.go", Old: []byte("package blob\n"), New: []byte("package blob\n")},
+	}
+	patch := FormatPatch("Wharf <wharf@example.com>", "Add zOS support", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), files)
+
+	dir := t.TempDir()
+	for _, file := range files {
+		if file.Old == nil {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(file.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, file.Old, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	patchFile := filepath.Join(t.TempDir(), "add-zos.patch")
+	if err := os.WriteFile(patchFile, patch, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(git, "apply", "--verbose", patchFile)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git apply: %v\n%s\n%s", err, output, patch)
+	}
+
+	for _, file := range files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file.Name)))
+		if err != nil {
+			t.Errorf("%v: %v", file.Name, err)
+		} else if string(got) != string(file.New) {
+			t.Errorf("%v: expected %q, got %q", file.Name, file.New, got)
+		}
+	}
+
+	if !strings.Contains(string(patch), " 2 file(s) changed, 4 insertions(+), 1 deletions(-)\n create mode 100644 sdk/blob/ioctl_zos.go\n") {
+		t.Errorf("unexpected summary:\n%s", patch)
+	}
+}
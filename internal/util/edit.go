@@ -5,22 +5,9 @@ package util
 import (
 	"bytes"
 	"fmt"
-	"go/ast"
 	"go/format"
-	"go/token"
-	"strings"
 )
 
-func Format(src *ast.File, fset *token.FileSet) ([]byte, error) {
-	b := new(strings.Builder)
-	err := format.Node(b, fset, src)
-	if err != nil {
-		return nil, err
-	}
-
-	return []byte(b.String()), nil
-}
-
 // Adds the 'zos' build tag to a file
 func AppendTagString(src []byte, tag string, op string, notice string) ([]byte, error) {
 	var err error
@@ -6,18 +6,63 @@ package util
 
 import (
 	"embed"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
 const INTERNAL_PATH_PREFIX = "//:INTERNAL/"
 
-// go:embed include
+//go:embed include
 var included embed.FS
 
+// Path of a bundled resource in the embedded file system
+func internalPath(file string) string {
+	return path.Join("include", strings.TrimPrefix(file, INTERNAL_PATH_PREFIX))
+}
+
 func ReadFile(path string) ([]byte, error) {
 	if strings.HasPrefix(path, INTERNAL_PATH_PREFIX) {
-		return included.ReadFile(strings.TrimPrefix(path, INTERNAL_PATH_PREFIX))
+		return included.ReadFile(internalPath(path))
 	}
 	return os.ReadFile(path)
 }
+
+// Read the entries of a folder, or of a bundled folder
+func ReadDir(path string) ([]fs.DirEntry, error) {
+	if strings.HasPrefix(path, INTERNAL_PATH_PREFIX) {
+		return included.ReadDir(internalPath(path))
+	}
+	return os.ReadDir(path)
+}
+
+// Describe a file, or a bundled resource
+func Stat(path string) (fs.FileInfo, error) {
+	if strings.HasPrefix(path, INTERNAL_PATH_PREFIX) {
+		return fs.Stat(included, internalPath(path))
+	}
+	return os.Stat(path)
+}
+
+// Resolve a path relative to a folder, paths relative to bundled folders stay bundled
+//
+// Absolute and bundled paths are returned as is
+func ResolvePath(dir string, file string) string {
+	switch {
+	case strings.HasPrefix(file, INTERNAL_PATH_PREFIX) || filepath.IsAbs(file):
+		return file
+	case strings.HasPrefix(dir, INTERNAL_PATH_PREFIX):
+		return INTERNAL_PATH_PREFIX + path.Join(strings.TrimPrefix(dir, INTERNAL_PATH_PREFIX), file)
+	}
+	return filepath.Join(dir, file)
+}
+
+// Folder of a file, or of a bundled resource
+func Dir(file string) string {
+	if strings.HasPrefix(file, INTERNAL_PATH_PREFIX) {
+		return INTERNAL_PATH_PREFIX + path.Dir(strings.TrimPrefix(file, INTERNAL_PATH_PREFIX))
+	}
+	return filepath.Dir(file)
+}
@@ -9,6 +9,8 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"golang.org/x/tools/go/vcs"
 )
@@ -20,7 +22,11 @@ func CloneModuleFromCache(dstdir string, modpath string) error {
 		return err
 	}
 
-	// Copy module to workspace
+	return CopyModule(dstdir, srcdir, modpath)
+}
+
+// Copies the folder of a module (eg. in the module cache) to the given path, generating a go.mod if it has none
+func CopyModule(dstdir string, srcdir string, modpath string) error {
 	if err := copyAll(dstdir, srcdir); err != nil {
 		return err
 	}
@@ -28,6 +34,91 @@ func CloneModuleFromCache(dstdir string, modpath string) error {
 	return generate(filepath.Join(dstdir, "go.mod"), goModTemplate(modpath))
 }
 
+// Apply the changes a diff makes to the files of a module in place
+//
+// Paths in the diff are relative to the root of the repository, only the files in the folder
+// of the module (subdir) are changed
+func PatchModule(dir string, subdir string, diff []byte) error {
+	applied := 0
+	for _, file := range SplitDiff(diff) {
+		name := file.Name
+		if subdir != "" {
+			if !strings.HasPrefix(name, subdir+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(name, subdir+"/")
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		if file.Deleted {
+			if err := os.Remove(target); err != nil {
+				return fmt.Errorf("%v: %w", name, err)
+			}
+			applied++
+			continue
+		}
+
+		original := target
+		if file.Created {
+			original = ""
+		} else if _, err := os.Stat(target); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		patched := target + ".wharf-patched"
+		if err := Patch(original, patched, file.Section); err != nil {
+			os.Remove(patched)
+			return fmt.Errorf("%v: %w", name, err)
+		}
+		if err := os.Rename(patched, target); err != nil {
+			return err
+		}
+		applied++
+	}
+
+	if applied == 0 {
+		return fmt.Errorf("no changes to files of the module")
+	}
+	return nil
+}
+
+// Name of the patch file for a module version (eg. azure-sdk-for-go--sdk-storage-azblob-v1.1.0.patch)
+func PatchFileName(modPath string, version string) string {
+	repo, subdir := SplitModulePath(modPath)
+	name := repo + "--"
+	if subdir != "" {
+		name += strings.ReplaceAll(subdir, "/", "-") + "-"
+	}
+	return name + strings.TrimSuffix(version, "+incompatible") + ".patch"
+}
+
+// Split a module path into the name of its repository and the folder of the module inside it
+//
+// Major version suffixes are dropped as they don't name a folder in the repository
+func SplitModulePath(modPath string) (string, string) {
+	segments := strings.Split(modPath, "/")
+	if last := segments[len(segments)-1]; len(segments) > 1 && strings.HasPrefix(last, "v") {
+		if _, err := strconv.Atoi(last[1:]); err == nil {
+			segments = segments[:len(segments)-1]
+		}
+	}
+
+	// Hosts that keep repositories under an owner (eg. github.com/<owner>/<repo>)
+	root := 2
+	switch segments[0] {
+	case "github.com", "gitlab.com", "bitbucket.org", "golang.org":
+		root = 3
+	}
+	if root > len(segments) {
+		root = len(segments)
+	}
+
+	return segments[root-1], strings.Join(segments[root:], "/")
+}
+
 // Copies a module to the given path
 func CloneModuleFromVCS(dstdir string, modpath string, version string) error {
 	repo, err := vcs.RepoRootForImportPath(modpath, false)
@@ -110,9 +201,12 @@ func copyDir(dst, src string) error {
 	return nil
 }
 
+// First line of the go.mod file generated for imported modules
+const GOMOD_NOTICE = "// Generated by IBM Wharf; DO NOT EDIT."
+
 func goModTemplate(path string) string {
 	// TODO: figure out a way to make sure we keep the same versions for stuff
-	return "// Generated by IBM Wharf; DO NOT EDIT.\nmodule " + path + "\n"
+	return GOMOD_NOTICE + "\nmodule " + path + "\n"
 }
 
 func generate(file, content string) error {
@@ -0,0 +1,39 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Paths of the diff are relative to the root of the repository, the module lives in sdk/blob
+func TestPatchModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ioctl.go"), []byte("package blob\n\nconst x = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PatchModule(dir, "sdk/blob", []byte(testFormatPatch)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"ioctl.go":     "package blob\n\nconst x = 2\n",
+		"ioctl_zos.go": "package blob\n\nconst y = 1\n",
+	}
+	for name, src := range expected {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+		} else if string(got) != src {
+			t.Errorf("%v: expected %q, got %q", name, src, got)
+		}
+	}
+
+	if err := PatchModule(dir, "sdk/queue", []byte(testFormatPatch)); err == nil {
+		t.Errorf("expected an error for a diff that changes no file of the module")
+	}
+}
@@ -0,0 +1,70 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+// This package is dedicated to the action log (gozos-port.log)
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Kinds of actions recorded in the action log
+const (
+	ACT_START     = "START"
+	ACT_EXEC      = "EXEC"
+	ACT_TYPECHECK = "TYPECHECK"
+	ACT_CONFIG    = "CONFIG"
+	ACT_PIN       = "PIN"
+	ACT_RELOAD    = "RELOAD"
+	ACT_EXPORT    = "EXPORT"
+	ACT_IMPORT    = "IMPORT"
+	ACT_WRITE     = "WRITE"
+	ACT_ERROR     = "ERROR"
+	ACT_ROLLBACK  = "ROLLBACK"
+)
+
+var actionLog struct {
+	sync.Mutex
+	out  io.Writer
+	echo io.Writer
+}
+
+// Open the action log, entries are appended to the file at the given path
+//
+// If echo is not nil every entry is also written to it
+func OpenActionLog(path string, echo io.Writer) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	actionLog.Lock()
+	actionLog.out = file
+	actionLog.echo = echo
+	actionLog.Unlock()
+
+	LogAction(ACT_START, "%v", os.Args)
+	return nil
+}
+
+// Record an action in the action log (does nothing if the log is not open)
+//
+// Entries are written one per line as: <timestamp> <kind> <message>
+func LogAction(kind string, format string, args ...any) {
+	actionLog.Lock()
+	defer actionLog.Unlock()
+
+	if actionLog.out == nil {
+		return
+	}
+
+	line := fmt.Sprintf("%v %-9v %v\n", time.Now().Format(time.RFC3339Nano), kind, fmt.Sprintf(format, args...))
+	io.WriteString(actionLog.out, line)
+	if actionLog.echo != nil {
+		io.WriteString(actionLog.echo, line)
+	}
+}
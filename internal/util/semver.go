@@ -0,0 +1,61 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Check a version against a constraint, a list of comparisons that all have to hold
+// (separated by spaces or commas), eg. ">=v0.10.0 <v0.15.0"
+//
+// Comparisons use one of <, <=, >, >=, = and !=, a version on its own has to match exactly
+func MatchVersion(constraint string, version string) (bool, error) {
+	fields := strings.FieldsFunc(constraint, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) == 0 {
+		return false, fmt.Errorf("empty version constraint")
+	}
+
+	match := true
+	for _, field := range fields {
+		op := strings.TrimRight(field, "v0123456789.-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		if !strings.HasPrefix(field[len(op):], "v") {
+			return false, fmt.Errorf("invalid version constraint %q", field)
+		}
+		want := field[len(op):]
+		if !semver.IsValid(want) {
+			return false, fmt.Errorf("invalid version %q in constraint %q", want, constraint)
+		}
+
+		// Versions that aren't known (eg. of main modules) don't match any constraint
+		if !semver.IsValid(version) {
+			match = false
+			continue
+		}
+		cmp := semver.Compare(version, want)
+
+		var ok bool
+		switch op {
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "=", "":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			return false, fmt.Errorf("invalid operator %q in constraint %q", op, constraint)
+		}
+		match = match && ok
+	}
+	return match, nil
+}
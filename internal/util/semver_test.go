@@ -0,0 +1,40 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package util
+
+import (
+	"testing"
+)
+
+func TestMatchVersion(t *testing.T) {
+	cases := []struct {
+		constraint, version string
+		expected            bool
+	}{
+		{"<v0.15.0", "v0.14.9", true},
+		{"<v0.15.0", "v0.15.0", false},
+		{"<=v0.15.0", "v0.15.0", true},
+		{">=v1.1.20 <v1.1.21", "v1.1.20", true},
+		{">=v1.1.20, <v1.1.21", "v1.1.21", false},
+		{"v1.1.17", "v1.1.17", true},
+		{"=v1.1.17", "v1.1.20", false},
+		{"!=v1.1.17", "v1.1.20", true},
+		{">v0.1.0", "", false},
+	}
+
+	for _, tc := range cases {
+		got, err := MatchVersion(tc.constraint, tc.version)
+		if err != nil {
+			t.Errorf("%q %v: %v", tc.constraint, tc.version, err)
+		} else if got != tc.expected {
+			t.Errorf("%q %v: expected %v, got %v", tc.constraint, tc.version, tc.expected, got)
+		}
+	}
+
+	for _, invalid := range []string{"", "<", "~v1.0.0", "<1.0.0", "<v1.x"} {
+		if _, err := MatchVersion(invalid, "v1.0.0"); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
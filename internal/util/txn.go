@@ -0,0 +1,211 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+// This package is dedicated to undoing changes made to the filesystem
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Record of the files and folders changed by a run, so they can be restored if it fails
+type Transaction struct {
+	// Original state of touched files, in the order they were touched
+	files []TxnFile
+	seen  map[string]bool
+
+	// Folders created by the run
+	dirs []string
+}
+
+// Record of the changes made by a committed transaction, kept to revert them later
+type TxnRecord struct {
+	Time  time.Time
+	Args  []string
+	Files []TxnFile
+	Dirs  []string `json:",omitempty"`
+}
+
+// A file changed by a transaction
+type TxnFile struct {
+	Path string
+
+	// State of the file before the change
+	Created  bool        `json:",omitempty"`
+	Original []byte      `json:",omitempty"`
+	Mode     fs.FileMode `json:",omitempty"`
+
+	// Hash of the contents written by the transaction (set on commit)
+	Hash string `json:",omitempty"`
+}
+
+func NewTransaction() *Transaction {
+	return &Transaction{seen: make(map[string]bool)}
+}
+
+// Save the current state of a file before it gets changed
+//
+// Only the first call for a path is recorded, later calls keep the original state
+func (t *Transaction) Touch(path string) error {
+	if t.seen[path] {
+		return nil
+	}
+
+	file := TxnFile{Path: path}
+	if info, err := os.Stat(path); err == nil {
+		file.Mode = info.Mode().Perm()
+		if file.Original, err = os.ReadFile(path); err != nil {
+			return err
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		file.Created = true
+	} else {
+		return err
+	}
+
+	t.seen[path] = true
+	t.files = append(t.files, file)
+	return nil
+}
+
+// Create a folder (like os.Mkdir), removing it and its contents on rollback
+func (t *Transaction) Mkdir(path string, perm fs.FileMode) error {
+	if err := os.Mkdir(path, perm); err != nil {
+		return err
+	}
+	t.dirs = append(t.dirs, path)
+	return nil
+}
+
+// Restore every touched file and remove every created folder, in reverse order
+func (t *Transaction) Rollback() error {
+	err := restore(t.files, t.dirs)
+	t.reset()
+	return err
+}
+
+// Record of the changes made so far, to save once the run is committed and revert it later
+func (t *Transaction) Record() (TxnRecord, error) {
+	record := TxnRecord{
+		Time:  time.Now(),
+		Args:  os.Args,
+		Files: append([]TxnFile(nil), t.files...),
+		Dirs:  append([]string(nil), t.dirs...),
+	}
+
+	for idx := range record.Files {
+		hash, err := fileHash(record.Files[idx].Path)
+		if err != nil {
+			return record, err
+		}
+		record.Files[idx].Hash = hash
+	}
+
+	return record, nil
+}
+
+// Undo the changes made by a committed transaction
+//
+// Files changed since the transaction was committed are not touched unless force is set,
+// an error listing them is returned instead
+func Revert(record TxnRecord, force bool) error {
+	if !force {
+		var changed []string
+		for _, file := range record.Files {
+			if InDirs(file.Path, record.Dirs) {
+				continue
+			}
+
+			hash, err := fileHash(file.Path)
+			if err != nil {
+				return err
+			}
+			if hash != file.Hash {
+				changed = append(changed, file.Path)
+			}
+		}
+
+		if len(changed) > 0 {
+			return fmt.Errorf("files changed since they were written:\n\t%v", strings.Join(changed, "\n\t"))
+		}
+	}
+
+	return restore(record.Files, record.Dirs)
+}
+
+func (t *Transaction) reset() {
+	t.files = nil
+	t.seen = make(map[string]bool)
+	t.dirs = nil
+}
+
+// Put files back to their original state and remove folders, in reverse order
+func restore(files []TxnFile, dirs []string) error {
+	var errs []string
+	for idx := len(files) - 1; idx >= 0; idx-- {
+		file := files[idx]
+		if InDirs(file.Path, dirs) {
+			continue
+		}
+
+		var err error
+		if file.Created {
+			err = os.Remove(file.Path)
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = os.WriteFile(file.Path, file.Original, file.Mode)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("unable to restore %v: %v", file.Path, err))
+		} else {
+			LogAction(ACT_ROLLBACK, "restored %v", file.Path)
+		}
+	}
+
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		if err := os.RemoveAll(dirs[idx]); err != nil {
+			errs = append(errs, fmt.Sprintf("unable to remove %v: %v", dirs[idx], err))
+		} else {
+			LogAction(ACT_ROLLBACK, "removed %v", dirs[idx])
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// Check if a path lies inside one of the folders (or is one of them)
+func InDirs(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hash of the contents of a file, empty if the file does not exist
+func fileHash(path string) (string, error) {
+	src, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(src)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,118 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package util
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, src string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkTestFile(t *testing.T, path string, expected string) {
+	t.Helper()
+	if src, err := os.ReadFile(path); err != nil {
+		t.Error(err)
+	} else if string(src) != expected {
+		t.Errorf("%v: expected %q, got %q", path, expected, src)
+	}
+}
+
+func checkNotExist(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%v: expected it to be removed, got %v", path, err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "go.work")
+	created := filepath.Join(dir, "wharf.go")
+	nested := filepath.Join(dir, "cache", "m")
+	writeTestFile(t, existing, "go 1.18\n")
+
+	txn := NewTransaction()
+	if err := txn.Touch(existing); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, existing, "go 1.18\n\nuse ./cache/m\n")
+	// Only the first touch keeps the original contents
+	if err := txn.Touch(existing); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, existing, "go 1.18\n\nuse (\n\t./cache/m\n)\n")
+
+	if err := txn.Touch(created); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, created, "package wharf\n")
+
+	if err := txn.Mkdir(filepath.Join(dir, "cache"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Mkdir(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Files inside a created folder go with it
+	if err := txn.Touch(filepath.Join(nested, "go.mod")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(nested, "go.mod"), "module m\n")
+
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestFile(t, existing, "go 1.18\n")
+	checkNotExist(t, created)
+	checkNotExist(t, filepath.Join(dir, "cache"))
+
+	// Nothing is left to roll back
+	writeTestFile(t, existing, "go 1.19\n")
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	checkTestFile(t, existing, "go 1.19\n")
+}
+
+func TestRevert(t *testing.T) {
+	dir := t.TempDir()
+	changed := filepath.Join(dir, "go.work")
+	created := filepath.Join(dir, "wharf.go")
+	writeTestFile(t, changed, "go 1.18\n")
+
+	txn := NewTransaction()
+	for _, path := range []string{changed, created} {
+		if err := txn.Touch(path); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, path, "written by the run\n")
+	}
+	record, err := txn.Record()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Edited after the run
+	writeTestFile(t, changed, "edited\n")
+	if err := Revert(record, false); err == nil {
+		t.Fatal("expected revert to refuse changed files")
+	}
+	checkTestFile(t, changed, "edited\n")
+	checkTestFile(t, created, "written by the run\n")
+
+	if err := Revert(record, true); err != nil {
+		t.Fatal(err)
+	}
+	checkTestFile(t, changed, "go 1.18\n")
+	checkNotExist(t, created)
+}
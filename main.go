@@ -4,9 +4,11 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -34,23 +36,53 @@ var (
 	CommitSHA = ""
 )
 
+// Subcommands, selected by the first command line argument
+var commands = map[string]func(args []string){
+	"plan":    planMain,
+	"apply":   applyMain,
+	"explain": explainMain,
+	"revert":  revertMain,
+	"status":  statusMain,
+	"config":  configMain,
+	"patches": patchesMain,
+}
+
 func main() {
+	// Turn off log flags
+	log.SetFlags(0)
+
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse cmd line flags
 	helpFlag := flag.Bool("help", false, "Print help text")
 	tagsFlag := flag.String("tags", "", "List of build tags")
+	goosFlag := flag.String("goos", "", "Platform to port to (defaults to 'go env GOOS')")
+	goarchFlag := flag.String("goarch", "", "Architecture to port to (defaults to 'go env GOARCH')")
 	dryRunFlag := flag.Bool("n", false, "Enable dry mode, make suggestions but don't preform changes")
 	verboseFlag := flag.Bool("v", false, "Enable verbose output")
 	testFlag := flag.Bool("t", false, "Test the package after the porting stage")
 	vcsFlag := flag.Bool("q", false, "Clone the package from VCS")
-	configFlag := flag.String("config", "", "Config for additional code edits")
-	patchesFlag := flag.Bool("p", false, "Saves patch files to filesystem path")
+	var configFlag listFlag
+	flag.Var(&configFlag, "config", "Config for additional code edits (can be repeated)")
+	offlineFlag := flag.Bool("offline", false, "Never contact the network, only use the module cache and file:// proxies")
+	searchFlag := flag.String("search", "", "Search the versions of modules that need porting for one that builds as is (newest, closest, same-major)")
+	catalogFlag := flag.String("catalog", "", "Folder of patches for known module versions (defaults to the bundled deps-patches)")
+	stubsFlag := flag.Bool("stubs", false, "Generate stubs for missing definitions no inline directive covers")
+	nativeFlag := flag.Bool("native", false, "Check newer versions of imported modules for one that already builds on the platform")
+	patchesFlag := flag.Bool("p", false, "Save patch files for imported modules")
 	iDirFlag := flag.String("d", "", "Path to store imported modules") // TODO: Enable
 	forceFlag := flag.Bool("f", false, "Force operation even if imported module path exists")
 	versionFlag := flag.Bool("version", false, "Display version information")
+	jsonFlag := flag.Bool("json", false, "Print the porting results as JSON")
 	flag.Parse()
 
-	// Turn off log flags
-	log.SetFlags(0)
+	// Errors that stop the run before porting are reported in the JSON output too
+	jsonErrors = *jsonFlag
 
 	// If --help is passed
 	if *helpFlag {
@@ -77,25 +109,15 @@ func main() {
 
 	// Verify arg length
 	if flag.NArg() < 1 {
-		log.Fatal("no package paths provided; see 'wharf --help' for usage")
+		fatalf("no package paths provided; see 'wharf --help' for usage")
 	}
 
-	// Handle config file argument
-	if *configFlag != "" {
-		if err := base.LoadInlines(*configFlag); err != nil {
-			log.Fatal("unable to load inlines file", err)
-		}
+	if *offlineFlag {
+		goOffline(*vcsFlag)
 	}
 
-	if *patchesFlag && !*vcsFlag {
-		log.Fatal("cannot use -p flag without enabling vcs cloning")
-	}
-
-	if len(*tagsFlag) > 0 {
-		for _, tag := range strings.Split(*tagsFlag, ",") {
-			base.BuildTags[tag] = true
-		}
-	}
+	configure(*goosFlag, *goarchFlag, *tagsFlag, configFlag, *catalogFlag, *searchFlag, *stubsFlag)
+	base.FindNative = *nativeFlag
 
 	if len(*iDirFlag) > 0 {
 		base.ImportDir = *iDirFlag
@@ -103,162 +125,367 @@ func main() {
 
 	// Bypass if set to force operations (this is intended for scripts to be able to use if necessary)
 	if !*forceFlag {
-		_, dstErr := os.Lstat(base.ImportDir)
-		if dstErr == nil {
-			if isatty.IsTerminal(os.Stdin.Fd()) {
-				fmt.Printf("warning: import destination already exists: %v\n", base.ImportDir)
-				fmt.Println("warning: running Wharf may cause some data to get overridden")
-				fmt.Print("continue? [y/N]: ")
-				var confirm string
-				fmt.Scanln(&confirm)
-				if confirm != "y" && confirm != "Y" {
-					os.Exit(0)
-				}
-			} else {
-				log.Fatalf("error: import destination already exists: %v\n", base.ImportDir)
-			}
-		}
+		checkImportDir()
 	}
 
-	if *verboseFlag {
+	if *verboseFlag && !*jsonFlag {
 		fmt.Println("importing modules to:", base.ImportDir)
 	}
 
 	paths := flag.Args()
 
-	if base.GOWORK() == "" {
-		log.Fatalln("no workspace found; please initialize one using `go work init` and add modules")
+	wfWork := setupWorkspace(*verboseFlag)
+
+	out, err := main2(paths, *jsonFlag)
+
+	// Report the results and quit; in JSON mode all results are reported at once
+	exit := func(code int) {
+		cleanupWorkspace(wfWork)
+		if *jsonFlag {
+			printJson(out)
+		}
+		os.Exit(code)
 	}
 
-	// Setup a private go.work file to make changes to as we work - while keeping the original safe
-	wfWork := filepath.Join(filepath.Dir(base.GOWORK()), ".wharf.work")
-	if err := util.CopyFile(wfWork, base.GOWORK()); err != nil {
-		log.Fatalf("unable to create temporary workspace: %v\n", err)
+	// Record an error that stops the run, in JSON mode errors are reported in the output
+	fail := func(msg string) {
+		if *jsonFlag {
+			if out.Errors != "" {
+				out.Errors += "\n"
+			}
+			out.Errors += strings.TrimSpace(msg)
+			exit(1)
+		}
+		cleanupWorkspace(wfWork)
+		log.Fatalln(msg)
+	}
+
+	if err != nil {
+		if *jsonFlag {
+			exit(1)
+		}
+		log.Println(err.Error())
+		fail("porting failed due to errors mentioned above")
+	}
+
+	if !*jsonFlag {
+		fmt.Println("porting successful!")
+		printOutput(out)
 	}
-	defer func() {
-		if err := os.Remove(wfWork + ".sum"); err != nil && !errors.Is(err, os.ErrNotExist) {
-			log.Printf("unable to remove: %v: %v\n", wfWork+".sum", err)
+
+	// Don't apply next steps (patches), only show what they would change
+	if *dryRunFlag {
+		if !*jsonFlag {
+			if err := printDiffs(out); err != nil {
+				fail(err.Error())
+			}
 		}
-	}()
+		exit(0)
+	}
 
-	if err := os.MkdirAll(base.Cache, 0755); err != nil {
-		log.Fatalf("unable to create cache at %v: %v\n", base.Cache, err)
+	// Every change from here on is undone if the run fails
+	txn := util.NewTransaction()
+	rollback := func(err error) {
+		if rerr := txn.Rollback(); rerr != nil {
+			log.Println(rerr.Error())
+			fail(err.Error() + "\nUnable to undo all changes, see errors above.")
+		}
+		fail(err.Error() + "\nAll changes were undone.")
 	}
 
-	if err := os.Setenv("GOWORK", wfWork); err != nil {
-		log.Fatalf("unable to set GOWORK: %v\n", err)
+	if err := apply(out, *vcsFlag, txn); err != nil {
+		rollback(err)
 	}
 
-	out, err := main2(paths, false)
+	// Patches are made before the private workspace is removed
+	if *patchesFlag {
+		if err := generatePatchFiles(out, txn); err != nil {
+			rollback(err)
+		}
+	}
 
-	if err != nil {
-		log.Println(err.Error())
-		log.Fatalln("porting failed due to errors mentioned above")
+	if err := commitWorkspace(out, wfWork, txn, !*jsonFlag); err != nil {
+		rollback(err)
+	}
+	if err := recordRun(txn); err != nil {
+		rollback(err)
+	}
+	cleanupWorkspace(wfWork)
+
+	// Keep stdout clean for the JSON output
+	stdout := os.Stdout
+	if *jsonFlag {
+		stdout = os.Stderr
+	} else {
+		fmt.Println("patches applied successfully!")
 	}
 
-	fmt.Println("porting successful!")
-	fmt.Println("\n--- MODULE CHANGES ---")
 	for _, pin := range out.Modules {
-		printPin(pin)
+		if pin.PatchFile != "" {
+			fmt.Fprintln(stdout, "saved patch file:", pin.PatchFile)
+		}
 	}
-	fmt.Println("\n--- PACKAGE CHANGES ---")
-	for _, patch := range out.Packages {
-		printPatch(patch)
+
+	// TODO: remove
+	if *testFlag {
+		// Run tests
+		fmt.Fprintln(stdout, "\nRunning tests...")
+		if output, err := util.GoTest(paths); err != nil {
+			fmt.Fprintln(stdout, "Tests failed:\n"+output)
+		} else {
+			fmt.Fprintln(stdout, "Tests passed!")
+		}
 	}
 
-	// Don't apply next steps (patches)
-	if *dryRunFlag {
-		os.Exit(0)
+	exit(0)
+}
+
+// Apply the target platform, tags and inline config used while porting
+func configure(goos string, goarch string, buildTags string, configs []string, catalog string, search string, stubs bool) {
+	base.Stubs = stubs
+
+	if err := base.SetVersionSearch(search); err != nil {
+		fatalf("invalid -search: %v\n", err)
+	}
+
+	if goos != "" || goarch != "" {
+		if err := base.SetPlatform(goos, goarch); err != nil {
+			fatalf("unable to change target platform: %v\n", err)
+		}
+	}
+
+	// The bundled patches are for z/OS, a catalog given explicitly is used for any platform
+	if catalog != "" || base.GOOS() == "zos" {
+		loadCatalog(catalog)
+	}
+
+	// Layer the workspace config and the config file arguments over the defaults
+	if err := base.LoadConfig(configs); err != nil {
+		fatalf("unable to load config:\n%v\n", err)
+	}
+
+	if len(buildTags) > 0 {
+		for _, tag := range strings.Split(buildTags, ",") {
+			base.BuildTags[tag] = true
+		}
+	}
+}
+
+// Report errors that stop a run as the Errors of the JSON output (see fatalf)
+var jsonErrors = false
+
+// Report an error and quit, as JSON output if -json is set
+func fatalf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonErrors {
+		printJson(&base.Output{Errors: strings.TrimSpace(msg)})
+		os.Exit(1)
+	}
+	log.Fatal(msg)
+}
+
+// Keep Wharf and the go command from reaching the network (see base.SetOffline)
+func goOffline(useVCS bool) {
+	if useVCS {
+		fatalf("-q clones modules from VCS, it can't be used in offline mode")
+	}
+	if err := base.SetOffline(); err != nil {
+		fatalf("unable to enable offline mode: %v\n", err)
+	}
+}
+
+// Values of a flag that can be given several times
+type listFlag []string
+
+func (list *listFlag) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *listFlag) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// Confirm with the user before importing modules into a folder that already exists
+func checkImportDir() {
+	_, dstErr := os.Lstat(base.ImportDir)
+	if dstErr == nil {
+		// Never prompt in JSON mode, the prompt would end up in the output
+		if !jsonErrors && isatty.IsTerminal(os.Stdin.Fd()) {
+			fmt.Printf("warning: import destination already exists: %v\n", base.ImportDir)
+			fmt.Println("warning: running Wharf may cause some data to get overridden")
+			fmt.Print("continue? [y/N]: ")
+			var confirm string
+			fmt.Scanln(&confirm)
+			if confirm != "y" && confirm != "Y" {
+				os.Exit(0)
+			}
+		} else {
+			fatalf("error: import destination already exists: %v\n", base.ImportDir)
+		}
+	}
+}
+
+// Setup a private go.work file to make changes to as we work - while keeping the original safe
+//
+// Returns the path to the private copy, GOWORK is set to point to it.
+// Also opens the action log, echoing it to stderr if verbose is set
+func setupWorkspace(verbose bool) string {
+	if base.GOWORK() == "" {
+		fatalf("no workspace found; please initialize one using `go work init` and add modules")
+	}
+
+	logFile := filepath.Join(filepath.Dir(base.GOWORK()), base.LOG_FILE)
+	var echo io.Writer
+	if verbose {
+		echo = os.Stderr
+	}
+	if err := util.OpenActionLog(logFile, echo); err != nil {
+		fatalf("unable to open action log %v: %v\n", logFile, err)
+	}
+
+	wfWork := filepath.Join(filepath.Dir(base.GOWORK()), ".wharf.work")
+	if err := util.CopyFile(wfWork, base.GOWORK()); err != nil {
+		fatalf("unable to create temporary workspace: %v\n", err)
+	}
+	if _, err := os.Stat(base.GOWORK() + ".sum"); err == nil {
+		if err := util.CopyFile(wfWork+".sum", base.GOWORK()+".sum"); err != nil {
+			fatalf("unable to create temporary workspace: %v\n", err)
+		}
+	}
+
+	if err := os.MkdirAll(base.Cache, 0755); err != nil {
+		fatalf("unable to create cache at %v: %v\n", base.Cache, err)
+	}
+
+	if err := os.Setenv("GOWORK", wfWork); err != nil {
+		fatalf("unable to set GOWORK: %v\n", err)
 	}
 
+	return wfWork
+}
+
+// Import the modules and apply the package patches described by the output
+//
+// Changes are recorded in the transaction so they can be undone if anything fails
+func apply(out *base.Output, useVCS bool, txn *util.Transaction) error {
 	failed := false
 	madeImportDir := false
-	for _, pin := range out.Modules {
+	for idx := range out.Modules {
+		pin := &out.Modules[idx]
 		if pin.Imported {
 			if !madeImportDir {
 				madeImportDir = true
-				if err := os.Mkdir(base.ImportDir, 0755); err != nil {
-					log.Printf("ERROR: unable to create folder for importing modules: %v: %v", base.ImportDir, err)
-					failed = true
-					break
+				if err := txn.Mkdir(base.ImportDir, 0755); err != nil {
+					return fmt.Errorf("unable to create folder for importing modules: %v: %v", base.ImportDir, err)
 				}
+				out.ImportDir = base.ImportDir
 			}
 			pin.Dir = importFolderName(pin.Path)
 			pin.Dir = filepath.Join(base.ImportDir, pin.Dir)
-			if err := importModule(pin, *vcsFlag); err != nil {
+			if err := importModule(*pin, useVCS); err != nil {
 				failed = true
-				log.Printf("ERROR: unable to import module %v@%v: %v\n", pin.Path, pin.Pinned, err)
+				log.Printf("ERROR: unable to import module %v@%v: %v\n", pin.Source(), pin.Pinned, err)
 			}
 		}
 	}
 
 	if failed {
-		log.Fatalln("\nAn error occurred while importing modules.\nPatches will need to be applied manually.")
+		return errors.New("\nAn error occurred while importing modules.")
 	}
 
-	for _, patch := range out.Packages {
-		if err := applyPatch(patch); err != nil {
+	for idx := range out.Packages {
+		patch := &out.Packages[idx]
+		if err := applyPatch(patch, txn); err != nil {
 			failed = true
 			log.Printf("unable to apply patch for %v: %v\n", patch.Path, err)
 		}
 	}
 
 	if failed {
-		log.Fatalln("\nAn error occurred while applying patches.\nPlease apply missing patches manually.")
+		return errors.New("\nAn error occurred while applying patches.")
 	}
 
+	return nil
+}
+
+// Replace the user's go.work and go.work.sum with our private copies, keeping a backup of go.work
+func commitWorkspace(out *base.Output, wfWork string, txn *util.Transaction, verbose bool) error {
 	backup := base.GOWORK() + ".backup"
-	if err = util.CopyFile(backup, base.GOWORK()); err != nil {
-		log.Printf("unable to backup workspace to %v: %v\n", backup, err)
-	} else if err = util.CopyFile(base.GOWORK(), wfWork); err != nil {
-		log.Printf("unable to update workspace: %v\n", wfWork)
-	} else {
-		fmt.Println("backed up workspace to", backup)
+	if err := txn.Touch(backup); err != nil {
+		return fmt.Errorf("unable to backup workspace to %v: %w", backup, err)
+	}
+	if err := util.CopyFile(backup, base.GOWORK()); err != nil {
+		return fmt.Errorf("unable to backup workspace to %v: %w", backup, err)
 	}
 
-	if err != nil {
-		log.Println("An error occurred:")
-		log.Println("\tUnable to replace the current GOWORK file with our copy.")
-		log.Println("\tTherefore, some patches might not be applied.")
-		log.Println("\tOur copy is located here:", wfWork)
-	} else {
-		if err := os.Remove(wfWork); err != nil {
-			log.Printf("unable to remove: %v: %v\n", wfWork, err)
+	for _, file := range []string{"", ".sum"} {
+		if _, err := os.Stat(wfWork + file); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err := txn.Touch(base.GOWORK() + file); err != nil {
+			return fmt.Errorf("unable to update workspace: %w", err)
+		}
+		if err := util.CopyFile(base.GOWORK()+file, wfWork+file); err != nil {
+			return fmt.Errorf("unable to update workspace: %w", err)
 		}
 	}
 
-	if err := os.RemoveAll(base.Cache); err != nil {
-		log.Printf("unable to remove cache: %v: %v\n", base.Cache, err)
+	out.GoWorkBackup = backup
+	if verbose {
+		fmt.Println("backed up workspace to", backup)
 	}
 
-	fmt.Println("patches applied successfully!")
+	return nil
+}
 
-	// TODO: remove
-	if *testFlag {
-		// Run tests
-		fmt.Println("\nRunning tests...")
-		if output, err := util.GoTest(paths); err != nil {
-			fmt.Println("Tests failed:\n" + output)
-		} else {
-			fmt.Println("Tests passed!")
+func printOutput(out *base.Output) {
+	fmt.Println("\n--- MODULE CHANGES ---")
+	for _, pin := range out.Modules {
+		printPin(pin)
+	}
+	fmt.Println("\n--- PACKAGE CHANGES ---")
+	for _, patch := range out.Packages {
+		printPatch(patch)
+	}
+
+	if len(out.Offline) > 0 {
+		fmt.Println("\n--- LIMITED BY OFFLINE MODE ---")
+		for _, note := range out.Offline {
+			fmt.Println("-", note)
 		}
 	}
 }
 
 func printPin(pin base.ModulePin) {
 	fmt.Printf("# %v (%v): ", pin.Path, pin.Version)
-	if pin.Imported {
+	if pin.Imported && pin.Redirect != "" {
+		fmt.Printf("IMPORTED FROM %v@%v\n", pin.Redirect, pin.Pinned)
+	} else if pin.Imported && pin.Patch != "" {
+		fmt.Println("IMPORTED WITH CATALOG PATCH", pin.Patch)
+	} else if pin.Imported {
 		fmt.Println("IMPORTED")
+	} else if pin.Redirect != "" {
+		fmt.Printf("REDIRECTED TO %v@%v\n", pin.Redirect, pin.Pinned)
 	} else if pin.Pinned != pin.Version {
 		fmt.Println("UPDATED TO", pin.Pinned)
 	} else {
 		fmt.Println("PINNED")
 	}
+
+	if pin.Native != "" {
+		fmt.Printf("- %v of this module already builds on %v, upgrade to it instead of importing the module\n", pin.Native, base.GOOS())
+	}
 }
 
 func printPatch(patch base.PackagePatch) {
 	fmt.Println("#", patch.Path)
 
+	if patch.Native != "" {
+		fmt.Printf("- %v of the module already builds on %v\n", patch.Native, base.GOOS())
+	}
+
 	if len(patch.Tags) == 0 {
 		fmt.Println("- applied manual patch")
 		return
@@ -275,7 +502,16 @@ func printPatch(patch base.PackagePatch) {
 
 	for _, file := range patch.Files {
 		fmt.Printf("- %v:\n", file.Name)
-		if file.BaseFile == "" {
+		if file.Generated {
+			for _, symbol := range file.Symbols {
+				fmt.Printf("\tdeclared stub %v for %v\n", symbol.New, symbol.Original)
+			}
+		} else if file.Diff != "" {
+			if file.BaseFile != "" {
+				fmt.Printf("\tcopied to %v\n", file.BaseFile)
+			}
+			fmt.Printf("\tpatched with %v\n", file.Diff)
+		} else if file.BaseFile == "" {
 			if !file.Build {
 				fmt.Printf("\tadded tag '!%v'\n", base.GOOS())
 			} else {
@@ -289,6 +525,10 @@ func printPatch(patch base.PackagePatch) {
 			}
 		}
 	}
+
+	for _, warning := range patch.Warnings {
+		fmt.Println("- warning:", warning)
+	}
 }
 
 func importModule(pin base.ModulePin, useVCS bool) error {
@@ -299,11 +539,22 @@ func importModule(pin base.ModulePin, useVCS bool) error {
 	if useVCS {
 		if err := util.CloneModuleFromVCS(
 			pin.Dir,
-			pin.Path,
+			pin.Source(),
 			strings.TrimSuffix(pin.Pinned, "+incompatible"),
 		); err != nil {
 			return err
 		}
+
+		// The copy in the module cache was patched, the clone has to be patched too
+		if pin.Patch != "" {
+			diff, err := base.ReadCatalogPatch(pin.Patch)
+			if err != nil {
+				return err
+			}
+			if err := util.PatchModule(pin.Dir, "", diff); err != nil {
+				return fmt.Errorf("unable to apply catalog patch %v: %w", pin.Patch, err)
+			}
+		}
 	} else {
 		if err := util.CloneModuleFromCache(pin.Dir, pin.Path); err != nil {
 			return err
@@ -325,95 +576,167 @@ func importModule(pin base.ModulePin, useVCS bool) error {
 		return err
 	}
 
+	util.LogAction(util.ACT_IMPORT, "%v@%v: imported to %v", pin.Source(), pin.Pinned, pin.Dir)
 	return nil
 }
 
-func applyPatch(patch base.PackagePatch) error {
+func applyPatch(patch *base.PackagePatch, txn *util.Transaction) error {
 	patch.Dir, _ = util.GoListPkgDir(patch.Path)
 
-	resolveFilePath := func(file string) string {
-		return filepath.Join(patch.Dir, file)
+	edits, err := renderPatch(patch)
+	if err != nil {
+		return err
 	}
 
-	if patch.Template {
-		for _, file := range patch.Files {
-			if file.BaseFile != "" {
-				if err := util.CopyFile(resolveFilePath(file.Name), file.Cached); err != nil {
-					return err
-				}
-			}
+	for _, edit := range edits {
+		if err := writePatchFile(txn, edit.Path, edit.Src); err != nil {
+			return err
 		}
-		return nil
 	}
 
-	// Apply changes to files that were changed
-	for _, file := range patch.Files {
-		if file.BaseFile != "" {
-			// Copy the file from the cache
-			if err := util.CopyFile(resolveFilePath(file.Name), file.Cached); err != nil {
-				return err
-			}
+	return nil
+}
 
-			// Add the file tag
-			src, err := util.Format(file.Syntax, pkg2.FileSet)
-			if err != nil {
-				return err
-			}
+// A file written by a patch
+type fileEdit struct {
+	Path string
 
-			src, err = util.AppendTagString(src, base.GOOS(), "", fmt.Sprintf(base.FILE_NOTICE, file.BaseFile))
-			if err != nil {
-				return err
-			}
+	// Contents of the file before and after the patch (Orig is nil if the file is created)
+	Orig []byte
+	Src  []byte
+}
 
-			err = os.WriteFile(resolveFilePath(file.Name), src, 0744)
-			if err != nil {
-				return err
+// Produce the files a patch writes to patch.Dir, without touching disk
+func renderPatch(patch *base.PackagePatch) ([]fileEdit, error) {
+	var edits []fileEdit
+	for _, file := range patch.Files {
+		var src []byte
+		var err error
+
+		if patch.Template {
+			if !file.FromCache() {
+				continue
 			}
-		} else if file.Build {
-			// Append zos tag
-			src, err := util.Format(file.Syntax, pkg2.FileSet)
-			if err != nil {
-				return err
+			// Copy the file from the cache as is
+			src, err = os.ReadFile(file.Cached)
+		} else if file.Generated {
+			// Copy the generated file from the cache and add the file tag
+			src, err = patchSource(patch, file)
+			if err == nil {
+				src, err = util.AppendTagString(src, base.GOOS(), "", fmt.Sprintf(base.STUB_NOTICE, base.GOOS()))
 			}
-
-			src, err = util.AppendTagString(src, base.GOOS(), "||", fmt.Sprintf(base.TAG_NOTICE, base.GOOS()))
-			if err != nil {
-				return err
+		} else if file.Diff != "" {
+			// Copy the file patched by a diff from the cache and add the file tag
+			src, err = patchSource(patch, file)
+			if err == nil {
+				src, err = util.AppendTagString(src, base.GOOS(), "", fmt.Sprintf(base.DIFF_NOTICE, filepath.Base(file.Diff)))
 			}
-
-			name := file.Name
-			cnstr, _ := tags.ParseFileName(name)
-			if cnstr != nil {
-				name = strings.TrimSuffix(name, ".go") + "_" + base.GOOS() + ".go"
+		} else if file.BaseFile != "" {
+			// Copy the file from the cache and add the file tag
+			src, err = patchSource(patch, file)
+			if err == nil {
+				src, err = util.AppendTagString(src, base.GOOS(), "", fmt.Sprintf(base.FILE_NOTICE, file.BaseFile))
 			}
-
-			err = os.WriteFile(resolveFilePath(name), src, 0744)
-			if err != nil {
-				return err
+		} else if file.Build {
+			// Append zos tag
+			src, err = patchSource(patch, file)
+			if err == nil {
+				src, err = util.AppendTagString(src, base.GOOS(), "||", fmt.Sprintf(base.TAG_NOTICE, base.GOOS()))
 			}
 		} else {
 			// Append !zos tag
-			src, err := util.Format(file.Syntax, pkg2.FileSet)
-			if err != nil {
-				return err
+			src, err = patchSource(patch, file)
+			if err == nil {
+				src, err = util.AppendTagString(src, "!"+base.GOOS(), "&&", fmt.Sprintf(base.TAG_NOTICE, "!"+base.GOOS()))
 			}
+		}
+		if err != nil {
+			return nil, err
+		}
 
-			src, err = util.AppendTagString(src, "!"+base.GOOS(), "&&", fmt.Sprintf(base.TAG_NOTICE, "!"+base.GOOS()))
-			if err != nil {
-				return err
-			}
+		path := filepath.Join(patch.Dir, patchFileName(file))
+		orig, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			orig = nil
+		} else if err != nil {
+			return nil, err
+		}
 
-			err = os.WriteFile(resolveFilePath(file.Name), src, 0744)
-			if err != nil {
-				return err
+		edits = append(edits, fileEdit{Path: path, Orig: orig, Src: src})
+	}
+
+	return edits, nil
+}
+
+// Print the changes each patch would make as unified diffs
+func printDiffs(out *base.Output) error {
+	fmt.Println("\n--- DIFFS ---")
+	for idx := range out.Packages {
+		patch := &out.Packages[idx]
+		if patch.Error != "" {
+			continue
+		}
+
+		edits, err := renderPatch(patch)
+		if err != nil {
+			return fmt.Errorf("unable to render patch for %v: %w", patch.Path, err)
+		}
+
+		for _, edit := range edits {
+			oldName := edit.Path
+			if edit.Orig == nil {
+				oldName = "/dev/null"
 			}
+			os.Stdout.Write(util.UnifiedDiff(oldName, edit.Path, edit.Orig, edit.Src))
 		}
+	}
+	return nil
+}
 
+// Name of the file a patch is written to
+//
+// Files constrained to another platform by their name are written to a new _<goos> file
+func patchFileName(file base.FilePatch) string {
+	if !file.FromCache() && file.Build {
+		if cnstr, _ := tags.ParseFileName(file.Name, base.GOARCH()); cnstr != nil {
+			return tags.TargetFileName(file.Name, base.GOOS())
+		}
 	}
+	return file.Name
+}
 
+// Write a patched file, recording it in the action log
+func writePatchFile(txn *util.Transaction, path string, src []byte) error {
+	if err := txn.Touch(path); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, src, 0744); err != nil {
+		return err
+	}
+	util.LogAction(util.ACT_WRITE, "%v", path)
 	return nil
 }
 
+// Read the source of a file to patch, generated files are read from the cache
+//
+// The source is read back (rather than printed from its syntax) so comments are kept,
+// it is gofmt'd when its build tag is edited (see util.AppendTagString)
+func patchSource(patch *base.PackagePatch, file base.FilePatch) ([]byte, error) {
+	path := filepath.Join(patch.Dir, file.Name)
+	if file.FromCache() {
+		path = file.Cached
+	}
+	return os.ReadFile(path)
+}
+
+func printJson(out *base.Output) {
+	if outstrm, err := json.MarshalIndent(out, "", "\t"); err == nil {
+		fmt.Println(string(outstrm))
+	} else {
+		fmt.Println(err.Error())
+	}
+}
+
 func importFolderName(importPath string) string {
 	segments := strings.Split(importPath, "/")
 	base := segments[len(segments)-1]
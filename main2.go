@@ -4,11 +4,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/zosopentools/wharf/internal/base"
 	"github.com/zosopentools/wharf/internal/pkg2"
 	"github.com/zosopentools/wharf/internal/port2"
+	"github.com/zosopentools/wharf/internal/util"
 )
 
 func main2(
@@ -16,14 +25,21 @@ func main2(
 	mute bool,
 ) (*base.Output, error) {
 	ctx := port2.NewContext()
-	if err := run(paths, ctx, mute); err != nil {
-		return nil, err
-	}
+	err := run(paths, ctx, mute)
 
 	out := &base.Output{
 		Modules:  ctx.CollectPins(),
 		Packages: ctx.CollectPatches(),
 	}
+	if base.FindNative {
+		port2.FindNativeSupport(out)
+	}
+	out.Offline = base.OfflineNotes
+
+	if err != nil {
+		out.Errors = err.Error()
+		return out, err
+	}
 
 	return out, nil
 }
@@ -74,11 +90,18 @@ load:
 
 			result, err := ctx.Port(pkg)
 			if result == port2.RESULT_ERROR || err != nil {
-				fmt.Printf("package require manual porting: %v\n\t%v\n", pkg.Meta.ImportPath, err.Error())
+				if !mute {
+					fmt.Printf("package require manual porting: %v\n\t%v\n", pkg.Meta.ImportPath, err.Error())
+					if perr, ok := err.(port2.PatchError); ok && perr.Suggestion != "" {
+						fmt.Printf("\tsuggestion: %v\n", perr.Suggestion)
+					}
+					fmt.Printf("\tfor details run: wharf explain %v %v\n", pkg.Meta.ImportPath, strings.Join(paths, " "))
+				}
 				return err
 			}
 
 			if result == port2.RESULT_RELOAD {
+				util.LogAction(util.ACT_RELOAD, "%v: module versions changed, reloading packages", pkg.Meta.ImportPath)
 				goto load
 			}
 		}
@@ -87,14 +110,121 @@ load:
 	return nil
 }
 
-func generatePatchFiles(path string) error {
-	// outdir, _ := filepath.Abs(base.GOWORK())
-	// outdir = filepath.Dir(outdir)
-	// for path := range diffs {
-	// 	out := filepath.Join(outdir, filepath.Base(path)+".patch")
-	// 	if err := util.GitDiff(path, out); err != nil {
-	// 		fmt.Fprintf(os.Stderr, "Unable to produce patch file for repo located at %v: %v", path, err.Error())
-	// 	}
-	// }
+// Save a patch file for every imported module, holding the changes made to it
+//
+// Patches are made against the module cache copy of the module, so no VCS checkout
+// is needed. They are written to the workspace folder and named like the files in deps-patches
+func generatePatchFiles(out *base.Output, txn *util.Transaction) error {
+	outdir := filepath.Dir(base.GOWORK())
+
+	failed := false
+	for idx := range out.Modules {
+		pin := &out.Modules[idx]
+		if !pin.Imported {
+			continue
+		}
+
+		if err := generatePatchFile(pin, out.Packages, outdir, txn); err != nil {
+			failed = true
+			log.Printf("unable to produce patch file for %v@%v: %v\n", pin.Source(), pin.Pinned, err)
+		}
+	}
+
+	if failed {
+		return errors.New("\nAn error occurred while producing patch files.")
+	}
+
+	return nil
+}
+
+func generatePatchFile(pin *base.ModulePin, patches []base.PackagePatch, outdir string, txn *util.Transaction) error {
+	origDir, err := util.GoModDownloadDir(pin.Source(), pin.Pinned)
+	if err != nil {
+		return err
+	}
+
+	// Paths in the patch are relative to the root of the repository
+	_, subdir := util.SplitModulePath(pin.Source())
+
+	// Files changed in the module, relative to its folder
+	var names []string
+	seen := make(map[string]bool)
+	for _, patch := range patches {
+		if patch.Module != pin.Path {
+			continue
+		}
+
+		rel, err := filepath.Rel(pin.Dir, patch.Dir)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range patch.Files {
+			name := filepath.Join(rel, patchFileName(file))
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	// The changes of the catalog patch the module was imported with are part of the patch too
+	if pin.Patch != "" {
+		diff, err := base.ReadCatalogPatch(pin.Patch)
+		if err != nil {
+			return err
+		}
+		for _, file := range util.SplitDiff(diff) {
+			name := strings.TrimPrefix(file.Name, subdir+"/")
+			if file.Deleted || (subdir != "" && name == file.Name) {
+				continue
+			}
+			if name = filepath.FromSlash(name); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	var files []util.FileDiff
+	for _, name := range names {
+		src, err := os.ReadFile(filepath.Join(pin.Dir, name))
+		if err != nil {
+			return err
+		}
+
+		orig, err := os.ReadFile(filepath.Join(origDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			orig = nil
+		} else if err != nil {
+			return err
+		}
+
+		files = append(files, util.FileDiff{
+			Name: path.Join(subdir, filepath.ToSlash(name)),
+			Old:  orig,
+			New:  src,
+		})
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	src := util.FormatPatch("IBM Wharf <wharf@localhost>", fmt.Sprintf("Add %v support to %v@%v", base.GOOS(), pin.Source(), pin.Pinned), time.Now(), files)
+	patchFile := filepath.Join(outdir, util.PatchFileName(pin.Source(), pin.Pinned))
+	if err := txn.Touch(patchFile); err != nil {
+		return err
+	}
+	if err := os.WriteFile(patchFile, src, 0644); err != nil {
+		return err
+	}
+
+	pin.PatchFile = patchFile
+	util.LogAction(util.ACT_WRITE, "%v", patchFile)
 	return nil
 }
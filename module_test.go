@@ -28,8 +28,10 @@ import (
 type jsonOut struct {
 	Modules  []base.ModulePin
 	Packages []base.PackagePatch
+	Offline  []string `json:",omitempty"`
 }
 
+// Runs wharf's main in the test binary, with the arguments of the test binary
 const WHARF_TEST_RUN = "WHARF_TEST_RUN"
 
 //go:embed test/expected/*.json
@@ -40,6 +42,7 @@ var config []byte
 
 var doLongTests = flag.Bool("long", false, "run long tests")
 var doLatest = flag.Bool("latest", false, "run tests on latest versions of modules")
+var offline = flag.Bool("offline", false, "skip tests that need network access")
 
 var goVersionRx = regexp.MustCompile(`go1.([0-9]+)(?:.([0-9]+))?`)
 var moduleNameRx = regexp.MustCompile(`/([a-zA-Z0-9.\-_~]+)(?:/v([0-9]+))?$`)
@@ -108,23 +111,26 @@ func satisfyGoVersion(ver string) (bool, error) {
 }
 
 func TestMain(m *testing.M) {
-	flag.Parse()
-
+	// Arguments are wharf's, not the test flags
 	if _, ranAsWharf := os.LookupEnv(WHARF_TEST_RUN); ranAsWharf {
-		if out, err := main2(os.Args[1:], true); err == nil {
-			printJson(out)
-		} else {
-			fmt.Printf("unable to port: %v", err)
-		}
-	} else {
-		os.Exit(m.Run())
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		main()
+		return
 	}
+
+	flag.Parse()
+	os.Exit(m.Run())
 }
 
 func TestModules(t *testing.T) {
 	var err error
 	var modules map[string]Module
 
+	// Modules are cloned from their repositories
+	if *offline {
+		t.Skip("skipping tests that need network access")
+	}
+
 	if testBin, err = os.Executable(); err != nil {
 		t.Fatalf("unable to get test executable: %v", err)
 	}
@@ -251,9 +257,9 @@ func TestModules(t *testing.T) {
 						t.Fatalf("unable to create cache at %v: %v\n", base.Cache, err)
 					}
 
-					cmd = exec.Command(testBin, test.Paths...)
+					cmd = exec.Command(testBin, append([]string{"-n", "-json"}, test.Paths...)...)
 					cmd.Dir = testRoot
-					cmd.Env = append(os.Environ(), "WHARF_TEST_RUN=1")
+					cmd.Env = append(os.Environ(), WHARF_TEST_RUN+"=1")
 					var stdout bytes.Buffer
 					var stderr bytes.Buffer
 					cmd.Stdout = &stdout
@@ -265,41 +271,12 @@ func TestModules(t *testing.T) {
 					}
 					// fmt.Println(stderr.String())
 					// fmt.Println(stdout.String())
-					out := jsonOut{}
+					out := base.Output{}
 					if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
 						t.Fatalf("unable to parse output: %v", err)
 					}
-
-					if len(expect.Modules) != len(out.Modules) {
-						t.FailNow()
-					}
-					moduleSet := make(map[string]*base.ModulePin, len(expect.Modules))
-					for i := range expect.Modules {
-						mod := &expect.Modules[i]
-						moduleSet[mod.Path] = mod
-					}
-					for _, oMod := range out.Modules {
-						if eMod, ok := moduleSet[oMod.Path]; !ok {
-							t.FailNow()
-						} else if !compareModules(eMod, &oMod) {
-							t.Fatalf("incorrect pinning: %v", eMod.Path)
-						}
-					}
-
-					if len(expect.Packages) != len(out.Packages) {
-						t.FailNow()
-					}
-					packageSet := make(map[string]*base.PackagePatch, len(expect.Packages))
-					for i := range expect.Packages {
-						pkg := &expect.Packages[i]
-						packageSet[pkg.Path] = pkg
-					}
-					for _, oPkg := range out.Packages {
-						if ePkg, ok := packageSet[oPkg.Path]; !ok {
-							t.FailNow()
-						} else if !comparePackages(ePkg, &oPkg) {
-							t.Fatalf("incorrect patch: %v", ePkg.Path)
-						}
+					if !test.simple {
+						compareOutput(t, &expect, &out, false)
 					}
 				})
 			}
@@ -307,19 +284,21 @@ func TestModules(t *testing.T) {
 	}
 }
 
-func compareModules(a *base.ModulePin, b *base.ModulePin) bool {
+// Compare module pins, with exactPins the version pinned must be the same too (not only whether it changed)
+func compareModules(a *base.ModulePin, b *base.ModulePin, exactPins bool) bool {
 	if a.Path != b.Path || a.Version != b.Version {
 		return false
 	}
 
-	aVerChanged := a.Pinned != a.Version
-	bVerChanged := b.Pinned != b.Version
-	if aVerChanged != bVerChanged {
+	if exactPins {
+		if a.Pinned != b.Pinned {
+			return false
+		}
+	} else if (a.Pinned != a.Version) != (b.Pinned != b.Version) {
 		return false
 	}
 
-	if a.Imported != b.Imported {
-
+	if a.Imported != b.Imported || a.Native != b.Native || a.Redirect != b.Redirect {
 		return false
 	}
 
@@ -327,7 +306,7 @@ func compareModules(a *base.ModulePin, b *base.ModulePin) bool {
 }
 
 func comparePackages(a *base.PackagePatch, b *base.PackagePatch) bool {
-	if a.Path != b.Path || a.Module != b.Module {
+	if a.Path != b.Path || a.Module != b.Module || a.Native != b.Native {
 		return false
 	}
 
@@ -372,7 +351,7 @@ func comparePackages(a *base.PackagePatch, b *base.PackagePatch) bool {
 		for _, bSymbol := range bFile.Symbols {
 			if aSymbol, ok := symbols[bSymbol.Original]; !ok {
 				return false
-			} else if aSymbol.Original != bSymbol.Original {
+			} else if aSymbol.New != bSymbol.New {
 				return false
 			}
 		}
@@ -380,11 +359,3 @@ func comparePackages(a *base.PackagePatch, b *base.PackagePatch) bool {
 
 	return true
 }
-
-func printJson(out *base.Output) {
-	if outstrm, err := json.MarshalIndent(out, "", "\t"); err == nil {
-		fmt.Println(string(outstrm))
-	} else {
-		fmt.Println(err.Error())
-	}
-}
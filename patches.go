@@ -0,0 +1,202 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/util"
+)
+
+// Patches for known module versions, bundled as the default catalog
+//
+//go:embed deps-patches/*.patch deps-patches/modules.yaml
+var depsPatches embed.FS
+
+// Name of the bundled catalog, as reported to the user
+const bundledCatalog = "deps-patches (bundled)"
+
+// Use a folder of patches as the patch catalog, or the bundled deps-patches if dir is empty
+func loadCatalog(dir string) {
+	if dir == "" {
+		catalog, err := fs.Sub(depsPatches, "deps-patches")
+		if err != nil {
+			log.Fatalf("unable to load patch catalog: %v\n", err)
+		}
+		base.PatchCatalog = catalog
+		base.PatchCatalogName = bundledCatalog
+		return
+	}
+
+	if info, err := os.Stat(dir); err != nil {
+		log.Fatalf("unable to load patch catalog: %v\n", err)
+	} else if !info.IsDir() {
+		log.Fatalf("unable to load patch catalog: %v is not a folder\n", dir)
+	}
+	base.PatchCatalog = os.DirFS(dir)
+	base.PatchCatalogName = dir
+}
+
+// Inspect the patch catalog
+//
+// Usage: wharf patches list [-catalog]
+//
+//	wharf patches check [-catalog] [-offline] [modules]
+func patchesMain(args []string) {
+	if len(args) < 1 {
+		log.Fatal("no patches command provided (expected list or check); see 'wharf --help' for usage")
+	}
+
+	switch args[0] {
+	case "list":
+		patchesList(args[1:])
+	case "check":
+		patchesCheck(args[1:])
+	default:
+		log.Fatalf("unknown patches command %v (expected list or check)\n", args[0])
+	}
+}
+
+// Print every patch of the catalog with its subject and the files it changes
+func patchesList(args []string) {
+	fs := flag.NewFlagSet("patches list", flag.ExitOnError)
+	catalogFlag := fs.String("catalog", "", "Folder of patches for known module versions (defaults to the bundled deps-patches)")
+	fs.Parse(args)
+
+	loadCatalog(*catalogFlag)
+
+	names, err := base.CatalogPatches()
+	if err != nil {
+		log.Fatalf("unable to read patch catalog: %v\n", err)
+	}
+
+	fmt.Println("catalog:", base.PatchCatalogName)
+	for _, name := range names {
+		diff, err := base.ReadCatalogPatch(name)
+		if err != nil {
+			log.Fatalf("unable to read patch %v: %v\n", name, err)
+		}
+
+		fmt.Println("\n#", name)
+		if subject := util.PatchSubject(diff); subject != "" {
+			fmt.Println(subject)
+		}
+		if modPath, err := base.CatalogPatchModule(name, diff); err != nil {
+			log.Fatalf("unable to read patch catalog: %v\n", err)
+		} else if modPath != "" {
+			fmt.Println("module:", modPath)
+		} else {
+			fmt.Printf("module: unknown (not applied, add it to %v)\n", base.CATALOG_INDEX)
+		}
+		for _, file := range util.SplitDiff(diff) {
+			switch {
+			case file.Created:
+				fmt.Printf("\t%v (created)\n", file.Name)
+			case file.Deleted:
+				fmt.Printf("\t%v (deleted)\n", file.Name)
+			default:
+				fmt.Printf("\t%v\n", file.Name)
+			}
+		}
+	}
+}
+
+// Check that the catalog patches of modules (module@version, or a module at its workspace version)
+// still apply cleanly to a fresh copy of the module
+//
+// Checks every module in the build list of the workspace that has a catalog patch if none are given
+func patchesCheck(args []string) {
+	fs := flag.NewFlagSet("patches check", flag.ExitOnError)
+	catalogFlag := fs.String("catalog", "", "Folder of patches for known module versions (defaults to the bundled deps-patches)")
+	offlineFlag := fs.Bool("offline", false, "Never contact the network, only use the module cache and file:// proxies")
+	fs.Parse(args)
+
+	if *offlineFlag {
+		goOffline(false)
+	}
+
+	loadCatalog(*catalogFlag)
+
+	var mods []util.ModuleInfo
+	explicit := fs.NArg() > 0
+	if explicit {
+		for _, arg := range fs.Args() {
+			mod := util.ModuleInfo{Path: arg}
+			if idx := strings.LastIndex(arg, "@"); idx >= 0 {
+				mod.Path, mod.Version = arg[:idx], arg[idx+1:]
+			} else if version, err := util.GoListModVersion(arg); err != nil {
+				log.Fatalf("unable to find version of %v: %v\n", arg, err)
+			} else {
+				mod.Version = version
+			}
+			mods = append(mods, mod)
+		}
+	} else {
+		var err error
+		if mods, err = util.GoListModules(); err != nil {
+			log.Fatalf("unable to list workspace modules: %v\n", err)
+		}
+	}
+
+	checked, failed := 0, 0
+	for _, mod := range mods {
+		if mod.Version == "" {
+			continue
+		}
+
+		name, diff, err := base.CatalogPatch(mod.Path, mod.Version)
+		if err != nil {
+			fmt.Printf("%v@%v: %v\n", mod.Path, mod.Version, err)
+			continue
+		} else if diff == nil {
+			if explicit {
+				fmt.Printf("%v@%v: no catalog patch\n", mod.Path, mod.Version)
+			}
+			continue
+		}
+
+		checked++
+		if err := checkCatalogPatch(mod.Path, mod.Version, diff); err != nil {
+			failed++
+			fmt.Printf("%v: does not apply to %v@%v: %v\n", name, mod.Path, mod.Version, err)
+		} else {
+			fmt.Printf("%v: applies cleanly to %v@%v\n", name, mod.Path, mod.Version)
+		}
+	}
+
+	if checked == 0 && !explicit {
+		fmt.Println("no workspace module has a patch in catalog", base.PatchCatalogName)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// Apply a patch to a copy of a module version from the module cache
+func checkCatalogPatch(modPath string, version string, diff []byte) error {
+	srcdir, err := util.GoModDownloadDir(modPath, version)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "wharf-patches-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := util.CopyModule(dir, srcdir, modPath); err != nil {
+		return err
+	}
+
+	_, subdir := util.SplitModulePath(modPath)
+	return util.PatchModule(dir, subdir, diff)
+}
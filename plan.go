@@ -0,0 +1,388 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/port2"
+	"github.com/zosopentools/wharf/internal/util"
+)
+
+// Run the porting analysis and save the decided changes to a plan file
+//
+// Usage: wharf plan [flags] <packages>
+func planMain(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	tagsFlag := fs.String("tags", "", "List of build tags")
+	goosFlag := fs.String("goos", "", "Platform to port to (defaults to 'go env GOOS')")
+	goarchFlag := fs.String("goarch", "", "Architecture to port to (defaults to 'go env GOARCH')")
+	var configFlag listFlag
+	fs.Var(&configFlag, "config", "Config for additional code edits (can be repeated)")
+	offlineFlag := fs.Bool("offline", false, "Never contact the network, only use the module cache and file:// proxies")
+	searchFlag := fs.String("search", "", "Search the versions of modules that need porting for one that builds as is (newest, closest, same-major)")
+	catalogFlag := fs.String("catalog", "", "Folder of patches for known module versions (defaults to the bundled deps-patches)")
+	stubsFlag := fs.Bool("stubs", false, "Generate stubs for missing definitions no inline directive covers")
+	nativeFlag := fs.Bool("native", false, "Check newer versions of imported modules for one that already builds on the platform")
+	outFlag := fs.String("o", "", "File to write the plan to (defaults to stdout)")
+	verboseFlag := fs.Bool("v", false, "Enable verbose output")
+	fs.Parse(args)
+
+	// The plan is printed as JSON without -o, so are errors
+	jsonErrors = *outFlag == ""
+
+	if fs.NArg() < 1 {
+		fatalf("no package paths provided; see 'wharf --help' for usage")
+	}
+
+	if *offlineFlag {
+		goOffline(false)
+	}
+
+	configure(*goosFlag, *goarchFlag, *tagsFlag, configFlag, *catalogFlag, *searchFlag, *stubsFlag)
+	base.FindNative = *nativeFlag
+
+	plan := &base.Plan{
+		GOOS:      base.GOOS(),
+		GOARCH:    base.GOARCH(),
+		Workspace: base.GOWORK(),
+	}
+
+	wfWork := setupWorkspace(*verboseFlag)
+
+	out, err := main2(fs.Args(), *outFlag == "")
+	if err != nil {
+		cleanupWorkspace(wfWork)
+		if jsonErrors {
+			printJson(out)
+			os.Exit(1)
+		}
+		log.Println(err.Error())
+		fatalf("porting failed due to errors mentioned above")
+	}
+	plan.Output = *out
+
+	// Save the contents of generated files, the cache does not outlive this run
+	plan.Cache = make(map[string][]byte)
+	for _, patch := range plan.Packages {
+		for _, file := range patch.Files {
+			if !file.FromCache() {
+				continue
+			}
+
+			src, err := os.ReadFile(file.Cached)
+			if err != nil {
+				cleanupWorkspace(wfWork)
+				fatalf("unable to read cached file %v: %v\n", file.Cached, err)
+			}
+			plan.Cache[cacheKey(patch, file)] = src
+		}
+	}
+
+	// Save the catalog patches applied, the catalog may differ when the plan is applied
+	for _, pin := range plan.Modules {
+		if pin.Patch == "" {
+			continue
+		}
+
+		diff, err := base.ReadCatalogPatch(pin.Patch)
+		if err != nil {
+			cleanupWorkspace(wfWork)
+			fatalf("unable to read catalog patch %v: %v\n", pin.Patch, err)
+		}
+		if plan.Catalog == nil {
+			plan.Catalog = make(map[string][]byte)
+		}
+		plan.Catalog[pin.Patch] = diff
+	}
+
+	// Planning never touches the workspace
+	cleanupWorkspace(wfWork)
+
+	hash, err := workspaceHash(base.GOWORK(), out)
+	if err != nil {
+		fatalf("unable to read workspace: %v\n", err)
+	}
+	plan.WorkspaceHash = hash
+
+	data, err := json.MarshalIndent(plan, "", "\t")
+	if err != nil {
+		fatalf("unable to encode plan: %v\n", err)
+	}
+
+	if *outFlag == "" {
+		fmt.Println(string(data))
+		return
+	}
+
+	if err := os.WriteFile(*outFlag, data, 0644); err != nil {
+		fatalf("unable to write plan: %v\n", err)
+	}
+
+	printOutput(out)
+	fmt.Println("\nplan saved to", *outFlag)
+}
+
+// Apply a plan previously saved by 'wharf plan'
+//
+// Usage: wharf apply [flags] <plan>
+func applyMain(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	vcsFlag := fs.Bool("q", false, "Clone the package from VCS")
+	patchesFlag := fs.Bool("p", false, "Save patch files for imported modules")
+	iDirFlag := fs.String("d", "", "Path to store imported modules")
+	forceFlag := fs.Bool("f", false, "Force operation even if imported module path exists")
+	offlineFlag := fs.Bool("offline", false, "Never contact the network, only use the module cache and file:// proxies")
+	verboseFlag := fs.Bool("v", false, "Enable verbose output")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fatalf("expected a single plan file; see 'wharf --help' for usage")
+	}
+
+	if *offlineFlag {
+		goOffline(*vcsFlag)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fatalf("unable to read plan: %v\n", err)
+	}
+
+	var plan base.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		fatalf("unable to parse plan: %v\n", err)
+	}
+
+	// Edits are made for the platform the plan was computed for
+	if plan.GOOS != "" {
+		if err := base.SetPlatform(plan.GOOS, plan.GOARCH); err != nil {
+			fatalf("unable to change target platform: %v\n", err)
+		}
+	}
+
+	if err := verifyPlan(&plan, base.GOWORK()); err != nil {
+		fatalf("cannot apply plan: %v\n", err)
+	}
+
+	if len(*iDirFlag) > 0 {
+		base.ImportDir = *iDirFlag
+	}
+
+	if !*forceFlag {
+		checkImportDir()
+	}
+
+	wfWork := setupWorkspace(*verboseFlag)
+
+	// Restore generated files to the cache
+	for pidx := range plan.Packages {
+		patch := &plan.Packages[pidx]
+		for fidx := range patch.Files {
+			file := &patch.Files[fidx]
+			if !file.FromCache() {
+				continue
+			}
+
+			src, ok := plan.Cache[cacheKey(*patch, *file)]
+			if !ok {
+				cleanupWorkspace(wfWork)
+				fatalf("plan is missing the contents of %v\n", cacheKey(*patch, *file))
+			}
+
+			file.Cached = filepath.Join(base.Cache, filepath.FromSlash(cacheKey(*patch, *file)))
+			if err := os.MkdirAll(filepath.Dir(file.Cached), 0740); err != nil {
+				cleanupWorkspace(wfWork)
+				fatalf("unable to restore cache: %v\n", err)
+			}
+			if err := os.WriteFile(file.Cached, src, 0740); err != nil {
+				cleanupWorkspace(wfWork)
+				fatalf("unable to restore cache: %v\n", err)
+			}
+		}
+	}
+
+	// Restore the catalog patches the plan was computed with as the catalog
+	if len(plan.Catalog) > 0 {
+		catalog := filepath.Join(base.Cache, "catalog-patches")
+		if err := os.MkdirAll(catalog, 0740); err != nil {
+			cleanupWorkspace(wfWork)
+			fatalf("unable to restore catalog patches: %v\n", err)
+		}
+		for name, diff := range plan.Catalog {
+			if err := os.WriteFile(filepath.Join(catalog, filepath.Base(name)), diff, 0640); err != nil {
+				cleanupWorkspace(wfWork)
+				fatalf("unable to restore catalog patches: %v\n", err)
+			}
+		}
+		base.PatchCatalog = os.DirFS(catalog)
+		base.PatchCatalogName = fs.Arg(0)
+	}
+
+	// Replay the version pins the plan was computed with, pins that kept the version
+	// of a module without patching it left the module as is
+	for _, pin := range plan.Modules {
+		if pin.Pinned == pin.Version && pin.Redirect == "" && pin.Patch == "" {
+			continue
+		}
+
+		var err error
+		if pin.Patch != "" {
+			err = port2.ReplaceWithCatalogPatch(pin.Path, pin.Pinned, pin.Patch)
+		} else {
+			err = util.GoWorkEditReplace(pin.Path, pin.Source(), pin.Pinned)
+		}
+		if err != nil {
+			cleanupWorkspace(wfWork)
+			fatalf("unable to pin %v@%v: %v\n", pin.Source(), pin.Pinned, err)
+		}
+	}
+
+	out := &plan.Output
+	txn := util.NewTransaction()
+	rollback := func(err error) {
+		if rerr := txn.Rollback(); rerr != nil {
+			log.Println(rerr.Error())
+			cleanupWorkspace(wfWork)
+			fatalf("%v\nUnable to undo all changes, see errors above.", err)
+		}
+		cleanupWorkspace(wfWork)
+		fatalf("%v\nAll changes were undone.", err)
+	}
+
+	if err := apply(out, *vcsFlag, txn); err != nil {
+		rollback(err)
+	}
+
+	if *patchesFlag {
+		if err := generatePatchFiles(out, txn); err != nil {
+			rollback(err)
+		}
+	}
+
+	if err := commitWorkspace(out, wfWork, txn, true); err != nil {
+		rollback(err)
+	}
+	if err := recordRun(txn); err != nil {
+		rollback(err)
+	}
+	cleanupWorkspace(wfWork)
+
+	fmt.Println("patches applied successfully!")
+	for _, pin := range out.Modules {
+		if pin.PatchFile != "" {
+			fmt.Println("saved patch file:", pin.PatchFile)
+		}
+	}
+}
+
+// Check that the workspace (a go.work file) still matches the one the plan was computed against
+func verifyPlan(plan *base.Plan, gowork string) error {
+	if gowork != plan.Workspace {
+		return fmt.Errorf("plan was computed for workspace %v, current workspace is %v", plan.Workspace, gowork)
+	}
+
+	hash, err := workspaceHash(gowork, &plan.Output)
+	if err != nil {
+		return fmt.Errorf("unable to read workspace: %w", err)
+	}
+	if hash != plan.WorkspaceHash {
+		return errors.New("workspace has changed since the plan was computed")
+	}
+
+	for _, pin := range plan.Modules {
+		version, err := util.GoListModVersion(pin.Path)
+		if err != nil {
+			return fmt.Errorf("unable to find version of %v: %w", pin.Path, err)
+		}
+		if version != pin.Version {
+			return fmt.Errorf("%v is at version %v, plan was computed against %v", pin.Path, version, pin.Version)
+		}
+	}
+
+	return nil
+}
+
+// Remove the private workspace and the cache, pointing GOWORK back at the user's workspace
+func cleanupWorkspace(wfWork string) {
+	if err := os.Setenv("GOWORK", base.GOWORK()); err != nil {
+		log.Printf("unable to set GOWORK: %v\n", err)
+	}
+
+	for _, file := range []string{wfWork, wfWork + ".sum"} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("unable to remove: %v: %v\n", file, err)
+		}
+	}
+
+	if err := os.RemoveAll(base.Cache); err != nil {
+		log.Printf("unable to remove cache: %v: %v\n", base.Cache, err)
+	}
+}
+
+// Hash of the workspace files a plan depends on: go.work, the go.mod and go.sum of the workspace modules
+// and the source files of the planned patches, which are read again when the plan is applied
+//
+// Files of imported modules are left out, they are copied from the module cache when the plan is applied
+func workspaceHash(gowork string, out *base.Output) (string, error) {
+	var files []string
+	files = append(files, gowork, gowork+".sum")
+
+	mods, err := util.GoListMainModules()
+	if err != nil {
+		return "", err
+	}
+	for _, mod := range mods {
+		if mod.Dir != "" {
+			files = append(files, filepath.Join(mod.Dir, "go.mod"), filepath.Join(mod.Dir, "go.sum"))
+		}
+	}
+
+	imported := make(map[string]bool)
+	for _, pin := range out.Modules {
+		if pin.Imported {
+			imported[pin.Path] = true
+		}
+	}
+	for _, patch := range out.Packages {
+		if imported[patch.Module] {
+			continue
+		}
+		for _, file := range patch.Files {
+			files = append(files, filepath.Join(patch.Dir, file.Name))
+			if file.BaseFile != "" {
+				files = append(files, filepath.Join(patch.Dir, file.BaseFile))
+			}
+		}
+	}
+
+	// Missing files are part of the hash too, creating them changes it
+	hash := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(hash, "%v: missing\n", file)
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%v: %v\n", file, len(data))
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func cacheKey(patch base.PackagePatch, file base.FilePatch) string {
+	return path.Join(patch.Path, file.Name)
+}
@@ -0,0 +1,73 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zosopentools/wharf/internal/base"
+)
+
+func TestVerifyPlan(t *testing.T) {
+	dir := t.TempDir()
+	gowork := filepath.Join(dir, "go.work")
+	appDir := filepath.Join(dir, "app")
+	files := map[string]string{
+		gowork:                           "go 1.18\n\nuse ./app\n",
+		filepath.Join(appDir, "go.mod"):  "module example.com/app\n\ngo 1.18\n",
+		filepath.Join(appDir, "term.go"): "package app\n",
+	}
+	if err := os.Mkdir(appDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, src := range files {
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOWORK", gowork)
+
+	plan := &base.Plan{Workspace: gowork}
+	plan.Packages = []base.PackagePatch{{
+		Path:   "example.com/app",
+		Dir:    appDir,
+		Module: "example.com/app",
+		Files:  []base.FilePatch{{Name: "term.go", Build: true}},
+	}}
+	hash, err := workspaceHash(gowork, &plan.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan.WorkspaceHash = hash
+
+	if err := verifyPlan(plan, gowork); err != nil {
+		t.Fatalf("unchanged workspace: %v", err)
+	}
+	if err := verifyPlan(plan, filepath.Join(dir, "other.work")); err == nil {
+		t.Error("expected plan for another workspace to be refused")
+	}
+
+	// Edit each file between plan and apply
+	for path, src := range files {
+		if err := os.WriteFile(path, []byte(src+"\n// edited\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyPlan(plan, gowork); err == nil {
+			t.Errorf("expected plan to be refused after editing %v", path)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Creating go.sum changes the workspace too
+	if err := os.WriteFile(filepath.Join(appDir, "go.sum"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPlan(plan, gowork); err == nil {
+		t.Error("expected plan to be refused after creating go.sum")
+	}
+}
@@ -0,0 +1,139 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/util"
+)
+
+// Undo the last run recorded in the manifest
+//
+// Usage: wharf revert [flags]
+func revertMain(args []string) {
+	fs := flag.NewFlagSet("revert", flag.ExitOnError)
+	forceFlag := fs.Bool("f", false, "Revert even if files were changed since the run")
+	verboseFlag := fs.Bool("v", false, "Enable verbose output")
+	fs.Parse(args)
+
+	if base.GOWORK() == "" {
+		log.Fatalln("no workspace found; please initialize one using `go work init` and add modules")
+	}
+
+	logFile := filepath.Join(filepath.Dir(base.GOWORK()), base.LOG_FILE)
+	var echo io.Writer
+	if *verboseFlag {
+		echo = os.Stderr
+	}
+	if err := util.OpenActionLog(logFile, echo); err != nil {
+		log.Fatalf("unable to open action log %v: %v\n", logFile, err)
+	}
+
+	last, err := revertLast(manifestPath(), *forceFlag)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("reverted run from %v: %v\n", last.Time.Format(time.RFC1123), strings.Join(last.Args, " "))
+	for _, dir := range last.Dirs {
+		fmt.Println("- removed", dir)
+	}
+	for _, file := range last.Files {
+		if util.InDirs(file.Path, last.Dirs) {
+			continue
+		}
+		if file.Created {
+			fmt.Println("- deleted", file.Path)
+		} else {
+			fmt.Println("- restored", file.Path)
+		}
+	}
+}
+
+// Undo the last run recorded in a manifest and drop it from the manifest
+func revertLast(path string, force bool) (util.TxnRecord, error) {
+	runs, err := loadManifest(path)
+	if err != nil {
+		return util.TxnRecord{}, fmt.Errorf("unable to read manifest: %w", err)
+	}
+	if len(runs) == 0 {
+		return util.TxnRecord{}, errors.New("no runs to revert")
+	}
+
+	last := runs[len(runs)-1]
+	if err := util.Revert(last, force); err != nil {
+		return last, fmt.Errorf("unable to revert run from %v: %w\nuse -f to revert anyway", last.Time.Format(time.RFC1123), err)
+	}
+
+	if err := saveManifest(path, runs[:len(runs)-1]); err != nil {
+		return last, fmt.Errorf("unable to update manifest: %w", err)
+	}
+	return last, nil
+}
+
+// Save the changes made by a run to the manifest, so 'wharf revert' can undo them
+func recordRun(txn *util.Transaction) error {
+	path := manifestPath()
+	runs, err := loadManifest(path)
+	if err != nil {
+		return fmt.Errorf("unable to read manifest: %w", err)
+	}
+
+	record, err := txn.Record()
+	if err != nil {
+		return fmt.Errorf("unable to record changes: %w", err)
+	}
+
+	if err := saveManifest(path, append(runs, record)); err != nil {
+		return fmt.Errorf("unable to write manifest: %w", err)
+	}
+	return nil
+}
+
+func manifestPath() string {
+	return filepath.Join(filepath.Dir(base.GOWORK()), base.MANIFEST_FILE)
+}
+
+// Read the runs recorded in a manifest, oldest first
+func loadManifest(path string) ([]util.TxnRecord, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var runs []util.TxnRecord
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// Write the runs to a manifest, removing it if there are none left
+func saveManifest(path string, runs []util.TxnRecord) error {
+	if len(runs) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(runs, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
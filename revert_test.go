@@ -0,0 +1,71 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zosopentools/wharf/internal/util"
+)
+
+func TestRevertLast(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.json")
+	first := filepath.Join(dir, "first.go")
+	second := filepath.Join(dir, "second.go")
+
+	// Two runs, each writing one file
+	var runs []util.TxnRecord
+	for _, path := range []string{first, second} {
+		txn := util.NewTransaction()
+		if err := txn.Touch(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("package app\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		record, err := txn.Record()
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, record)
+	}
+	if err := saveManifest(manifest, runs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(second, []byte("package edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := revertLast(manifest, false); err == nil {
+		t.Fatal("expected revert to refuse an edited file")
+	}
+	if runs, err := loadManifest(manifest); err != nil || len(runs) != 2 {
+		t.Fatalf("expected the manifest to keep both runs, got %v (%v)", len(runs), err)
+	}
+
+	last, err := revertLast(manifest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Files[0].Path != second {
+		t.Errorf("expected the last run to be reverted, got %v", last.Files[0].Path)
+	}
+	if _, err := os.Stat(second); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed, got %v", second, err)
+	}
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("expected %v to be kept: %v", first, err)
+	}
+
+	runs, err = loadManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Files[0].Path != first {
+		t.Errorf("expected the manifest to only keep the first run, got %v", runs)
+	}
+}
@@ -0,0 +1,236 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/util"
+)
+
+// A workspace module carrying Wharf changes
+type statusModule struct {
+	Path string
+	Dir  string
+
+	// Set if the module was imported by Wharf (lives in the import folder or has a generated go.mod)
+	Imported bool `json:",omitempty"`
+
+	Packages []statusPackage `json:",omitempty"`
+}
+
+type statusPackage struct {
+	Path  string
+	Dir   string
+	Files []statusFile
+}
+
+// A file carrying a Wharf notice
+type statusFile struct {
+	Name string
+
+	// Tag added to the build constraint of the file
+	Tag string `json:",omitempty"`
+
+	// File the generated file was copied from
+	Original string `json:",omitempty"`
+
+	// Diff the generated file was patched with
+	Diff string `json:",omitempty"`
+
+	// Set if the file declares stubs of missing definitions
+	Stubs bool `json:",omitempty"`
+}
+
+// Report every change Wharf left in the workspace modules
+//
+// Usage: wharf status [flags]
+func statusMain(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Print the report as JSON")
+	fs.Parse(args)
+
+	if base.GOWORK() == "" {
+		log.Fatalln("no workspace found; please initialize one using `go work init` and add modules")
+	}
+
+	mods, err := util.GoListMainModules()
+	if err != nil {
+		log.Fatalf("unable to list workspace modules: %v\n", err)
+	}
+
+	var report []statusModule
+	for _, mod := range mods {
+		status, err := scanModule(mod)
+		if err != nil {
+			log.Fatalf("unable to scan %v: %v\n", mod.Path, err)
+		}
+		if status.Imported || len(status.Packages) > 0 {
+			report = append(report, status)
+		}
+	}
+
+	if *jsonFlag {
+		if outstrm, err := json.MarshalIndent(report, "", "\t"); err == nil {
+			fmt.Println(string(outstrm))
+		} else {
+			log.Fatalln(err.Error())
+		}
+		return
+	}
+
+	if len(report) == 0 {
+		fmt.Println("no Wharf changes found in workspace")
+		return
+	}
+
+	for _, mod := range report {
+		printStatus(mod)
+	}
+}
+
+func printStatus(mod statusModule) {
+	if mod.Imported {
+		fmt.Printf("# %v: IMPORTED to %v\n", mod.Path, mod.Dir)
+	} else {
+		fmt.Printf("# %v (%v)\n", mod.Path, mod.Dir)
+	}
+
+	for _, pkg := range mod.Packages {
+		fmt.Println("-", pkg.Path)
+		for _, file := range pkg.Files {
+			if file.Stubs {
+				fmt.Printf("\t%v: stubs of missing definitions\n", file.Name)
+			} else if file.Diff != "" {
+				fmt.Printf("\t%v: patched with %v\n", file.Name, file.Diff)
+			} else if file.Original != "" {
+				fmt.Printf("\t%v: generated from %v\n", file.Name, file.Original)
+			} else {
+				fmt.Printf("\t%v: added tag '%v'\n", file.Name, file.Tag)
+			}
+		}
+	}
+}
+
+// Find the Wharf notices in the files of a module
+func scanModule(mod util.ModuleInfo) (statusModule, error) {
+	status := statusModule{Path: mod.Path, Dir: mod.Dir}
+
+	gomod, err := os.ReadFile(filepath.Join(mod.Dir, "go.mod"))
+	if err != nil {
+		return status, err
+	}
+	rel, err := filepath.Rel(base.ImportDir, mod.Dir)
+	inImportDir := err == nil && !strings.HasPrefix(rel, "..")
+	status.Imported = inImportDir || bytes.HasPrefix(gomod, []byte(util.GOMOD_NOTICE))
+
+	pkgs := make(map[string]*statusPackage)
+	var order []string
+
+	err = filepath.WalkDir(mod.Dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if file == mod.Dir {
+				return nil
+			}
+			// Skip folders the go command ignores and nested modules
+			name := entry.Name()
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(file, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(file, ".go") {
+			return nil
+		}
+
+		found, err := scanFile(file)
+		if err != nil || found == nil {
+			return err
+		}
+
+		dir := filepath.Dir(file)
+		pkg, ok := pkgs[dir]
+		if !ok {
+			rel, _ := filepath.Rel(mod.Dir, dir)
+			pkg = &statusPackage{Path: path.Join(mod.Path, filepath.ToSlash(rel)), Dir: dir}
+			pkgs[dir] = pkg
+			order = append(order, dir)
+		}
+		pkg.Files = append(pkg.Files, *found)
+		return nil
+	})
+
+	for _, dir := range order {
+		status.Packages = append(status.Packages, *pkgs[dir])
+	}
+
+	return status, err
+}
+
+// Look for a Wharf notice in the comments before the package clause of a file
+//
+// Every comment before the package clause is checked, notices are added after any licence header
+func scanFile(file string) (*statusFile, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files that don't parse were never written by Wharf
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file, src, parser.ParseComments|parser.PackageClauseOnly)
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, group := range parsed.Comments {
+		if group.Pos() >= parsed.Package {
+			break
+		}
+
+		for _, comment := range group.List {
+			text := comment.Text
+			if strings.HasPrefix(text, "/*") {
+				text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+			}
+
+			for _, line := range strings.Split(text, "\n") {
+				if tag, ok := base.ParseNotice(base.TAG_NOTICE, line); ok {
+					return &statusFile{Name: filepath.Base(file), Tag: tag}, nil
+				}
+				if original, ok := base.ParseNotice(base.FILE_NOTICE, line); ok {
+					return &statusFile{Name: filepath.Base(file), Original: original}, nil
+				}
+				if diff, ok := base.ParseNotice(base.DIFF_NOTICE, line); ok {
+					return &statusFile{Name: filepath.Base(file), Diff: diff}, nil
+				}
+				if _, ok := base.ParseNotice(base.STUB_NOTICE, line); ok {
+					return &statusFile{Name: filepath.Base(file), Stubs: true}, nil
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
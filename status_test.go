@@ -0,0 +1,97 @@
+// Licensed Materials - Property of IBM
+// Copyright IBM Corp. 2023.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zosopentools/wharf/internal/base"
+	"github.com/zosopentools/wharf/internal/util"
+)
+
+func TestScanFile(t *testing.T) {
+	cases := []struct {
+		name     string
+		src      string
+		expected *statusFile
+	}{
+		{"tag", "//go:build zos\n// Tags altered by Wharf (added zos)\n\npackage app\n", &statusFile{Tag: "zos"}},
+		{"licence", "// Copyright 2023 The Authors\n\n// Tags altered by Wharf (added zos)\n\npackage app\n", &statusFile{Tag: "zos"}},
+		{"tag block", "/*\nTags altered by Wharf (added zos)\n*/\n\npackage app\n", &statusFile{Tag: "zos"}},
+		{"file", "// This file was generated by Wharf (original term_linux.go)\n\npackage app\n", &statusFile{Original: "term_linux.go"}},
+		{"file block", "/* This file was generated by Wharf (original term_linux.go) */\n\npackage app\n", &statusFile{Original: "term_linux.go"}},
+		{"diff", "// This file was generated by Wharf (patched with term.patch)\n\npackage app\n", &statusFile{Diff: "term.patch"}},
+		{"stubs", "// This file was generated by Wharf (stubs of definitions missing on zos)\n\npackage app\n", &statusFile{Stubs: true}},
+		// Only comments before the package clause are notices
+		{"after package", "package app\n\n// Tags altered by Wharf (added zos)\nvar x = 1\n", nil},
+		{"doc comment", "// Package app\npackage app\n\n/* This file was generated by Wharf (original term_linux.go) */\n", nil},
+		{"none", "// Package app\npackage app\n", nil},
+		{"no package", "// Tags altered by Wharf (added zos)\n", nil},
+	}
+
+	dir := t.TempDir()
+	for _, tc := range cases {
+		file := filepath.Join(dir, "term.go")
+		if err := os.WriteFile(file, []byte(tc.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if tc.expected != nil {
+			tc.expected.Name = "term.go"
+		}
+		found, err := scanFile(file)
+		if err != nil {
+			t.Errorf("%v: %v", tc.name, err)
+		} else if !reflect.DeepEqual(found, tc.expected) {
+			t.Errorf("%v: expected %+v, got %+v", tc.name, tc.expected, found)
+		}
+	}
+}
+
+func TestScanModule(t *testing.T) {
+	defer func(dir string) { base.ImportDir = dir }(base.ImportDir)
+	base.ImportDir = filepath.Join(t.TempDir(), "wharf_port")
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                   util.GOMOD_NOTICE + "\nmodule example.com/term\n",
+		"term.go":                  "package term\n",
+		"term_zos.go":              "// This file was generated by Wharf (original term_linux.go)\n\npackage term\n",
+		"unix/ioctl.go":            "//go:build linux || zos\n// Tags altered by Wharf (added zos)\n\npackage unix\n",
+		"testdata/term.go":         "// Tags altered by Wharf (added zos)\n\npackage testdata\n",
+		"nested/go.mod":            "module example.com/term/nested\n",
+		"nested/term.go":           "// Tags altered by Wharf (added zos)\n\npackage nested\n",
+		"unix/ioctl_linux_test.go": "package unix\n",
+	}
+	for name, src := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := scanModule(util.ModuleInfo{Path: "example.com/term", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := statusModule{
+		Path:     "example.com/term",
+		Dir:      dir,
+		Imported: true,
+		Packages: []statusPackage{
+			{Path: "example.com/term", Dir: dir, Files: []statusFile{{Name: "term_zos.go", Original: "term_linux.go"}}},
+			{Path: "example.com/term/unix", Dir: filepath.Join(dir, "unix"), Files: []statusFile{{Name: "ioctl.go", Tag: "zos"}}},
+		},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %+v, got %+v", expected, status)
+	}
+}
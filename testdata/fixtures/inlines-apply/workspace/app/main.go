@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/sig"
+)
+
+func main() {
+	fmt.Println(sig.Codes())
+}
@@ -0,0 +1,5 @@
+module example.com/app
+
+go 1.18
+
+require example.com/native v1.0.0
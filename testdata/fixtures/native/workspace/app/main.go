@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/native"
+)
+
+func main() {
+	fmt.Println(native.Name())
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/pinme"
+)
+
+func main() {
+	fmt.Println(pinme.Name())
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/parent"
+)
+
+func main() {
+	fmt.Println(parent.Describe())
+}
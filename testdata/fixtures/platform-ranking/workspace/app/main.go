@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/ranked"
+)
+
+func main() {
+	fmt.Println(ranked.Name())
+}
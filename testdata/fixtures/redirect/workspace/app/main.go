@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/legacy"
+)
+
+func main() {
+	fmt.Println(legacy.Name())
+}
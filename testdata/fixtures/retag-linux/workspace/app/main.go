@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/retag"
+)
+
+func main() {
+	fmt.Println(retag.Name())
+}
@@ -0,0 +1,5 @@
+package legacy
+
+func name() string {
+	return "fork"
+}
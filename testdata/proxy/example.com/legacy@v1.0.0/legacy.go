@@ -0,0 +1,5 @@
+package legacy
+
+func Name() string {
+	return name()
+}
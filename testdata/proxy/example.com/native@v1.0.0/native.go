@@ -0,0 +1,5 @@
+package native
+
+func Name() string {
+	return name()
+}
@@ -0,0 +1,6 @@
+package native
+
+// Name was renamed, so the app can't build with this version
+func Platform() string {
+	return name()
+}
@@ -0,0 +1,5 @@
+package native
+
+func name() string {
+	return "linux"
+}
@@ -0,0 +1,5 @@
+package child
+
+func Name() string {
+	return name()
+}
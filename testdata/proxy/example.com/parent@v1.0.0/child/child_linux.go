@@ -0,0 +1,7 @@
+package child
+
+const Size = 8
+
+func name() string {
+	return "linux"
+}
@@ -0,0 +1,5 @@
+//go:build !linux
+
+package child
+
+const Size = "big"
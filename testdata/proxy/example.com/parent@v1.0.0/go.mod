@@ -0,0 +1,3 @@
+module example.com/parent
+
+go 1.18
@@ -0,0 +1,9 @@
+package parent
+
+import "example.com/parent/child"
+
+var size string = child.Size
+
+func Describe() string {
+	return size + " " + child.Name()
+}
@@ -0,0 +1,3 @@
+module example.com/pinme
+
+go 1.18
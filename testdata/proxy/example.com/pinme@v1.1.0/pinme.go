@@ -0,0 +1,5 @@
+package pinme
+
+func Name() string {
+	return name()
+}
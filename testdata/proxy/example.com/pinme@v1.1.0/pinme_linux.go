@@ -0,0 +1,5 @@
+package pinme
+
+func name() string {
+	return "linux"
+}
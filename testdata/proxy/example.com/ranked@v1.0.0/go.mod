@@ -0,0 +1,3 @@
+module example.com/ranked
+
+go 1.18
@@ -0,0 +1,5 @@
+package ranked
+
+func Name() string {
+	return name()
+}
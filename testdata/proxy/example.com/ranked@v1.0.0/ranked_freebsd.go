@@ -0,0 +1,5 @@
+package ranked
+
+func name() string {
+	return "freebsd"
+}
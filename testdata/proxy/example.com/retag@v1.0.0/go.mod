@@ -0,0 +1,3 @@
+module example.com/retag
+
+go 1.18
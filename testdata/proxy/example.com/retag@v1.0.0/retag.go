@@ -0,0 +1,5 @@
+package retag
+
+func Name() string {
+	return name()
+}
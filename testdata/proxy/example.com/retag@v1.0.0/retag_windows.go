@@ -0,0 +1,5 @@
+package retag
+
+func name() string {
+	return "windows"
+}
@@ -0,0 +1,5 @@
+package sig
+
+func Codes() []int {
+	return codes()
+}
@@ -0,0 +1,7 @@
+package sig
+
+import "syscall"
+
+func codes() []int {
+	return []int{int(syscall.EBADFD), int(syscall.SIGSTKFLT)}
+}